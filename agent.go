@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Agent runs the program as a self-hosted testing server. The agent accepts the
+// same request that the API service accepts, executes a local test against the
+// website and responds with a JSON-encoded Result, which allows a coordinator
+// to list the agents in the configuration file next to the remote servers.
+//
+// curl -d "domain=example.com&location=a1b2c3d" http://localhost:8080/measure
+type Agent struct {
+	Title   string
+	Token   string
+	Timeout time.Duration
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (a Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if a.Token != "" {
+		_, password, _ := r.BasicAuth()
+
+		if subtle.ConstantTimeCompare([]byte(password), []byte(a.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), a.Timeout)
+	defer cancel()
+
+	unique := r.PostFormValue("location")
+	tester := &TTFB{
+		Domain: r.PostFormValue("domain"),
+		Servers: map[string]Server{
+			unique: {ID: unique, Title: a.Title},
+		},
+	}
+
+	var data Result
+
+	target, err := ParseTarget(tester.Domain)
+	tester.URL = target
+
+	if err != nil {
+		data = tester.BasicResult(unique)
+		data.Message = err.Error()
+	} else if result, err := tester.LocalCheck(ctx, unique); err != nil {
+		data = result
+		data.Message = err.Error()
+	} else {
+		data = result
+		data.Output.ServerID = unique
+		data.Output.ServerTitle = a.Title
+	}
+
+	data.Action = "load_time_tester"
+
+	w.Header().Set("content-type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		fmt.Fprintln(os.Stderr, "json.Encode", err)
+	}
+}
+
+// loopback returns true if the address only accepts connections from the same
+// machine, an empty host listens on every interface.
+func loopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// agentCommand starts the HTTP server of the agent mode. If a token is
+// specified the coordinator must include it as the password of the URL in the
+// configuration file, for example, "http://:secret@10.0.0.5:8080/measure". The
+// agent fetches any URL it receives, including internal addresses, so the
+// token is required to listen on an address reachable from other machines.
+func agentCommand(args []string) int {
+	hostname, _ := os.Hostname()
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	listen := flags.String("listen", "127.0.0.1:8080", "Address for the HTTP server, other than loopback requires -token")
+	title := flags.String("title", hostname, "Location reported in the results")
+	token := flags.String("token", "", "Password required to run the tests")
+	timeout := flags.Duration("timeout", time.Minute, "Maximum duration of each test")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *token == "" && !loopback(*listen) {
+		fmt.Fprintf(os.Stderr, "Agent listening on %s requires -token\n", *listen)
+		return 2
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/measure", Agent{Title: *title, Token: *token, Timeout: *timeout})
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	fmt.Fprintf(os.Stderr, "Agent listening on %s/measure\n", *listen)
+
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(os.Stderr, "ListenAndServe %s\n", err)
+		return 1
+	}
+
+	return 0
+}
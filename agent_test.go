@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAgentToken(t *testing.T) {
+	agent := Agent{Title: "Here", Token: "secret"}
+	form := url.Values{"domain": {"example.com"}, "location": {"a1b2c3d"}}
+
+	for _, password := range []string{"", "wrong", "secre", "secret2"} {
+		req := httptest.NewRequest(http.MethodPost, "/measure", strings.NewReader(form.Encode()))
+		req.Header.Set("content-type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("", password)
+
+		res := httptest.NewRecorder()
+		agent.ServeHTTP(res, req)
+
+		if res.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 with password %q, got %d", password, res.Code)
+		}
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		"localhost:8080": true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.5:8080":  false,
+		"8080":           false,
+	}
+
+	for address, expected := range tests {
+		if loopback(address) != expected {
+			t.Fatalf("expected %v for %q", expected, address)
+		}
+	}
+}
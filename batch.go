@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// batchWorkers is the number of simultaneous tests when multiple websites are
+// tested and the user did not specify one, otherwise a long list of websites
+// would send all the requests to the testing servers at once.
+const batchWorkers int = 8
+
+// ReadDomains returns the list of domain names in the file, one per line, or
+// from the standard input if the filename is a dash. Empty lines, duplicates
+// and comments using the same format as the configuration file are ignored.
+func ReadDomains(filename string) ([]string, error) {
+	var reader io.Reader
+
+	if filename == "-" {
+		reader = os.Stdin
+	} else {
+		file, err := os.Open(filename)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			if err := file.Close(); err != nil {
+				fmt.Println("file.Close", err)
+			}
+		}()
+
+		reader = file
+	}
+
+	var names []string
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0:1] == ";" || line[0:1] == "#" {
+			continue
+		}
+
+		if !seen[line] {
+			seen[line] = true
+			names = append(names, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s: domain list is empty", filename)
+	}
+
+	return names, nil
+}
+
+// AnalyzeAll tests multiple websites at the same time. The number of
+// simultaneous tests is limited by the limiter shared by the testers, if any,
+// so adding more websites does not increase the pressure on the testing
+// servers.
+func AnalyzeAll(ctx context.Context, testers []*TTFB, progress bool) {
+	var done int
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, tester := range testers {
+		wg.Add(1)
+
+		go func(tester *TTFB) {
+			defer wg.Done()
+
+			tester.Analyze(ctx, false)
+
+			if progress {
+				mutex.Lock()
+				done++
+				fmt.Printf("\rTesting %02d/%d domains ...", done, len(testers))
+				mutex.Unlock()
+			}
+		}(tester)
+	}
+
+	wg.Wait()
+
+	if progress {
+		// reset previous line.
+		fmt.Print("\r")
+	}
+}
+
+// ResultsByDomain groups the results of multiple websites by domain name.
+func ResultsByDomain(testers []*TTFB) map[string][]Result {
+	results := make(map[string][]Result)
+
+	for _, tester := range testers {
+		results[tester.Domain] = tester.Results
+	}
+
+	return results
+}
+
+// PrintSummary prints one row per website with the average timings and the
+// performance grade, ranked from the best to the worst grade. Websites with
+// the same grade are ranked by their average total time.
+func PrintSummary(testers []*TTFB) {
+	type summary struct {
+		Domain string
+		Rank   int
+		Conn   float64
+		TTFB   float64
+		TTL    float64
+		Fails  int
+		Grade  string
+	}
+
+	rows := make([]summary, 0, len(testers))
+
+	for _, tester := range testers {
+		rows = append(rows, summary{
+			Domain: tester.Domain,
+			Rank:   GradeRank(Score(tester).Grade),
+			Conn:   tester.Average(connectionTime),
+			TTFB:   tester.Average(timeToFirstByte),
+			TTL:    tester.Average(totalTime),
+			Fails:  tester.Failures(),
+			Grade:  PerformanceGrade(tester),
+		})
+	}
+
+	sort.SliceStable(rows, func(i int, j int) bool {
+		if rows[i].Rank != rows[j].Rank {
+			return rows[i].Rank < rows[j].Rank
+		}
+		return rows[i].TTL < rows[j].TTL
+	})
+
+	fmt.Println("┌─────┬──────────────────────────────┬───────┬───────┬───────┬───────┬────────────────────┐")
+	fmt.Println("│ #   │ Domain                       │ Conn  │ TTFB  │ TTL   │ Fails │ Grade              │")
+	fmt.Println("├─────┼──────────────────────────────┼───────┼───────┼───────┼───────┼────────────────────┤")
+
+	for idx, row := range rows {
+		fmt.Printf(
+			"│ %s │ %s │ %s │ %s │ %s │ %s │ %s │\n",
+			pad(fmt.Sprint(idx+1), 3),
+			pad(row.Domain, 28),
+			Colorize(connectionTime, row.Conn),
+			Colorize(timeToFirstByte, row.TTFB),
+			Colorize(totalTime, row.TTL),
+			pad(fmt.Sprint(row.Fails), 5),
+			row.Grade,
+		)
+	}
+
+	fmt.Println("└─────┴──────────────────────────────┴───────┴───────┴───────┴───────┴────────────────────┘")
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// exitBudget is the base exit code when at least one budget is violated, the
+// program adds one bit per type of violation, so the exit code tells which
+// budgets failed without parsing the output, for example, 16+1+4 = 21 means
+// the average time to first byte and the minimum grade were violated.
+const exitBudget int = 16
+
+const budgetAverage string = "max-ttfb"
+const budgetLocation string = "max-ttl"
+const budgetGrade string = "min-grade"
+const budgetFailures string = "max-failures"
+
+// budgetBits maps each budget to the bit added to the exit code.
+var budgetBits = map[string]int{
+	budgetAverage:  1,
+	budgetLocation: 2,
+	budgetGrade:    4,
+	budgetFailures: 8,
+}
+
+// Budget defines the limits that the results must respect, usually to stop a
+// deployment in a continuous integration pipeline when the responsiveness of
+// the website regresses. A zero value, or a negative number of failures,
+// disables the budget.
+type Budget struct {
+	MaxAverage  float64
+	MaxTTL      float64
+	MinGrade    string
+	MaxFailures int
+}
+
+// Violation describes one budget that was not respected.
+type Violation struct {
+	Budget   string      `json:"budget"`
+	Domain   string      `json:"domain"`
+	ServerID string      `json:"server_id,omitempty"`
+	Limit    interface{} `json:"limit"`
+	Value    interface{} `json:"value"`
+}
+
+// BudgetReport holds the result of the evaluation of the budgets.
+type BudgetReport struct {
+	Passed     bool        `json:"passed"`
+	ExitCode   int         `json:"exit_code"`
+	Violations []Violation `json:"violations"`
+}
+
+// Evaluate checks the results against the budgets. The average time to first
+// byte only includes the successful tests, see TTFB.SuccessfulAverage, and the
+// budget is violated if none of the tests succeeded. The total time of each
+// location is the median of its samples, which is the value itself when there
+// is only one sample.
+func (b Budget) Evaluate(t *TTFB) BudgetReport {
+	report := BudgetReport{Passed: true, Violations: []Violation{}}
+
+	if b.MaxAverage > 0 {
+		avg := t.SuccessfulAverage(timeToFirstByte)
+
+		if t.Statistics(timeToFirstByte).Count == 0 {
+			report.add(Violation{Budget: budgetAverage, Limit: b.MaxAverage, Value: "no successful tests"})
+		} else if avg > b.MaxAverage {
+			report.add(Violation{Budget: budgetAverage, Limit: b.MaxAverage, Value: avg})
+		}
+	}
+
+	if b.MaxTTL > 0 {
+		for _, loc := range t.Locations(totalTime) {
+			if loc.Stats.Count > 0 && loc.Stats.Median > b.MaxTTL {
+				report.add(Violation{
+					Budget:   budgetLocation,
+					ServerID: loc.ServerID,
+					Limit:    b.MaxTTL,
+					Value:    loc.Stats.Median,
+				})
+			}
+		}
+	}
+
+	if b.MinGrade != "" {
+		grade := Score(t).Grade
+
+		if GradeRank(grade) > GradeRank(b.MinGrade) {
+			report.add(Violation{Budget: budgetGrade, Limit: b.MinGrade, Value: grade})
+		}
+	}
+
+	if b.MaxFailures >= 0 {
+		if failures := t.Failures(); failures > b.MaxFailures {
+			report.add(Violation{Budget: budgetFailures, Limit: b.MaxFailures, Value: failures})
+		}
+	}
+
+	for idx := range report.Violations {
+		report.Violations[idx].Domain = t.Domain
+	}
+
+	return report
+}
+
+// Validate returns an error if the minimum grade does not exist.
+func (b Budget) Validate() error {
+	if b.MinGrade != "" && GradeRank(b.MinGrade) < 0 {
+		return fmt.Errorf("invalid grade %q, available: %v", b.MinGrade, grades)
+	}
+
+	return nil
+}
+
+// add appends the violation and sets the bit of the budget in the exit code.
+func (r *BudgetReport) add(v Violation) {
+	r.Passed = false
+	r.ExitCode |= exitBudget | budgetBits[v.Budget]
+	r.Violations = append(r.Violations, v)
+}
+
+// Merge combines the violations of another report, for example, the reports of
+// multiple websites tested at the same time, the exit code keeps the bits of
+// both reports.
+func (r *BudgetReport) Merge(other BudgetReport) {
+	r.Passed = r.Passed && other.Passed
+	r.ExitCode |= other.ExitCode
+	r.Violations = append(r.Violations, other.Violations...)
+}
+
+// Encode writes the JSON-encoded report.
+func (r BudgetReport) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// String implements the fmt.Stringer interface.
+func (v Violation) String() string {
+	if v.ServerID != "" {
+		return fmt.Sprintf("budget %s exceeded by %s: %v > %v", v.Budget, v.ServerID, precise(v.Value), precise(v.Limit))
+	}
+
+	return fmt.Sprintf("budget %s exceeded: %v (limit %v)", v.Budget, precise(v.Value), precise(v.Limit))
+}
+
+// precise returns floating points with the same precision used in the table.
+func precise(value interface{}) interface{} {
+	if number, ok := value.(float64); ok {
+		return fmt.Sprintf("%.3f", number)
+	}
+
+	return value
+}
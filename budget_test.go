@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+// TestEvaluateIgnoresFailures checks that failed tests, which report zero
+// timings, do not lower the average time to first byte.
+func TestEvaluateIgnoresFailures(t *testing.T) {
+	tester := &TTFB{Domain: "example.com"}
+
+	for i := 0; i < 3; i++ {
+		data := Result{Status: 1}
+		data.Output.FirstByteTime = 0.800
+		tester.Results = append(tester.Results, data)
+	}
+
+	for i := 0; i < 5; i++ {
+		tester.Results = append(tester.Results, Result{})
+	}
+
+	report := Budget{MaxAverage: 0.500, MaxFailures: -1}.Evaluate(tester)
+
+	if report.Passed || report.ExitCode != exitBudget|budgetBits[budgetAverage] {
+		t.Fatalf("expected a max-ttfb violation, got %+v", report)
+	}
+
+	tester.Results = tester.Results[3:]
+	report = Budget{MaxAverage: 0.500, MaxFailures: -1}.Evaluate(tester)
+
+	if report.Passed {
+		t.Fatal("expected a max-ttfb violation without successful tests")
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// catalog is the script used by the website of the service to render the map
+// of testing servers, it contains the identifier, the name and the coordinates
+// of every location.
+const catalog string = "https://performance.sucuri.net/assets/loadtime-parser.js"
+
+// builtinConfig is the name used in the errors of the built-in configuration.
+const builtinConfig string = "built-in webttfb.cfg"
+
+// catalogObject matches one object literal without nested objects.
+var catalogObject = regexp.MustCompile(`(?:["']?([\w-]+)["']?\s*:\s*)?\{([^{}]*)\}`)
+
+// catalogProperty matches one property of an object literal with a string or a
+// numeric value, the name of the property may be quoted.
+var catalogProperty = regexp.MustCompile(`["']?(\w+)["']?\s*:\s*("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|-?[0-9]+(?:\.[0-9]+)?)`)
+
+// catalogKeys maps the property names used by the script to the fields of the
+// server, the format of the script is not documented so the usual names of
+// each property are accepted.
+var catalogKeys = map[string]string{
+	"id":        "id",
+	"uid":       "id",
+	"unique":    "id",
+	"uniqueid":  "id",
+	"location":  "id",
+	"title":     "title",
+	"name":      "title",
+	"label":     "title",
+	"city":      "title",
+	"lat":       "latitude",
+	"latitude":  "latitude",
+	"lng":       "longitude",
+	"lon":       "longitude",
+	"long":      "longitude",
+	"longitude": "longitude",
+}
+
+// ParseCatalog extracts the testing servers from the script. Every object with
+// a title and coordinates is considered a server, the identifier is either a
+// property of the object or the key that holds it, e.g. "8e84827: {...}".
+func ParseCatalog(script string) ([]Server, error) {
+	var list []Server
+
+	seen := make(map[string]bool)
+
+	for _, object := range catalogObject.FindAllStringSubmatch(script, -1) {
+		var lat, long bool
+
+		entry := Server{ID: object[1], Enabled: true}
+
+		for _, prop := range catalogProperty.FindAllStringSubmatch(object[2], -1) {
+			value := prop[2]
+
+			if value[0] == '"' || value[0] == '\'' {
+				value = unquoteJS(value)
+			}
+
+			switch catalogKeys[strings.ToLower(prop[1])] {
+			case "id":
+				entry.ID = value
+			case "title":
+				entry.Title = value
+			case "latitude":
+				entry.Latitude, _ = strconv.ParseFloat(value, 64)
+				lat = true
+			case "longitude":
+				entry.Longitude, _ = strconv.ParseFloat(value, 64)
+				long = true
+			}
+		}
+
+		if entry.ID == "" || entry.Title == "" || !lat || !long || seen[entry.ID] {
+			continue
+		}
+
+		seen[entry.ID] = true
+		list = append(list, entry)
+	}
+
+	if len(list) == 0 {
+		return nil, errors.New("catalog does not contain testing servers")
+	}
+
+	return list, nil
+}
+
+// unquoteJS removes the quotes and the escape characters of a JavaScript string.
+func unquoteJS(value string) string {
+	var b strings.Builder
+
+	value = value[1 : len(value)-1]
+
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+
+		b.WriteByte(value[i])
+	}
+
+	return b.String()
+}
+
+// FetchCatalog downloads the script from the URL, or reads it from the disk if
+// the source is not a URL, which is useful to work with a local copy.
+func FetchCatalog(ctx context.Context, source string) (string, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		data, err := os.ReadFile(source)
+		return string(data), err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if err2 := res.Body.Close(); err2 != nil {
+			fmt.Println("res.Body.Close", err2)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return "", errors.New(res.Status)
+	}
+
+	data, err := io.ReadAll(res.Body)
+
+	return string(data), err
+}
+
+// MergeCatalog updates the servers of the configuration with the catalog. The
+// options of the existing servers are preserved except for the title and the
+// coordinates, the servers of the service missing in the catalog are removed,
+// and the self-hosted agents are kept at the end of the list.
+func MergeCatalog(servers []Server, list []Server) []Server {
+	var merged []Server
+
+	existing := make(map[string]Server)
+	listed := make(map[string]bool)
+
+	for _, server := range servers {
+		existing[server.ID] = server
+	}
+
+	for _, entry := range list {
+		if server, ok := existing[entry.ID]; ok {
+			server.Title = entry.Title
+			server.Latitude = entry.Latitude
+			server.Longitude = entry.Longitude
+			entry = server
+		}
+
+		listed[entry.ID] = true
+		merged = append(merged, entry)
+	}
+
+	for _, server := range servers {
+		if listed[server.ID] || server.Prober == "" || server.Prober == defaultProber {
+			continue
+		}
+
+		merged = append(merged, server)
+	}
+
+	return merged
+}
+
+// WriteServer prints the server section using the configuration file format.
+func WriteServer(w io.Writer, s Server) {
+	fmt.Fprintf(w, "[server %s]\n", s.ID)
+	fmt.Fprintf(w, "title = %s\n", s.Title)
+
+	if !s.Enabled {
+		fmt.Fprintln(w, "enabled = false")
+	}
+
+	if s.Prober != "" {
+		fmt.Fprintf(w, "probe = %s\n", s.Prober)
+	}
+
+	if s.Address != "" {
+		fmt.Fprintf(w, "address = %s\n", s.Address)
+	}
+
+	if s.Region != "" {
+		fmt.Fprintf(w, "region = %s\n", s.Region)
+	}
+
+	if len(s.Tags) > 0 {
+		fmt.Fprintf(w, "tags = %s\n", strings.Join(s.Tags, ", "))
+	}
+
+	if s.Latitude != 0 || s.Longitude != 0 {
+		fmt.Fprintf(w, "latitude = %g\n", s.Latitude)
+		fmt.Fprintf(w, "longitude = %g\n", s.Longitude)
+	}
+}
+
+// RewriteServers replaces the testing servers of the configuration file with
+// the list. The other sections and their comments are preserved as they are,
+// the servers are written where the first server was defined, but comments
+// inside the server sections are lost, except for the comments right before
+// the header of another section or at the end of the file.
+func RewriteServers(content string, servers []Server) string {
+	var b strings.Builder
+	var section string
+	var written bool
+	var pending []string
+
+	// separate adds an empty line between the sections.
+	separate := func() {
+		if text := b.String(); text != "" && !strings.HasSuffix(text, "\n\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	// flush writes the comments that follow the last server, it returns
+	// false if there were none.
+	flush := func() bool {
+		for len(pending) > 0 && strings.TrimSpace(pending[0]) == "" {
+			pending = pending[1:]
+		}
+
+		if len(pending) == 0 {
+			return false
+		}
+
+		separate()
+
+		for _, line := range pending {
+			b.WriteString(line)
+		}
+
+		pending = nil
+
+		return true
+	}
+
+	emit := func() {
+		if written {
+			return
+		}
+
+		written = true
+
+		for _, server := range servers {
+			separate()
+			WriteServer(&b, server)
+		}
+	}
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		comment := trimmed == "" || trimmed[0:1] == ";" || trimmed[0:1] == "#"
+		header := trimmed != "" && trimmed[0:1] == "["
+
+		if header {
+			fields := strings.Fields(strings.Trim(trimmed, "[]"))
+			section = ""
+
+			if len(fields) > 0 {
+				section = fields[0]
+			}
+		}
+
+		// Legacy lines at the beginning of the file are servers too.
+		if section == "server" || section == "servers" || (section == "" && !comment) {
+			emit()
+
+			if comment && !header {
+				pending = append(pending, line)
+			} else {
+				pending = nil
+			}
+
+			continue
+		}
+
+		if header && written && !flush() {
+			separate()
+		}
+
+		b.WriteString(line)
+	}
+
+	emit()
+	flush()
+
+	return b.String()
+}
+
+// serversCommand inspects and updates the list of testing servers.
+func serversCommand(args []string) int {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "update") {
+		fmt.Fprintln(os.Stderr, "Usage: webttfb servers list|update [flags]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("servers "+args[0], flag.ExitOnError)
+	configFile := flags.String("config", "", "Configuration file, default $WEBTTFB_CONFIG or the first file found")
+	source := flags.String("source", catalog, "URL or local copy of the script with the locations")
+	dryRun := flags.Bool("dry-run", false, "Print the new configuration instead of writing it")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := FindConfig(*configFile)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfig %s\n", err)
+		return 1
+	}
+
+	if args[0] == "list" {
+		printServers(cfg)
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	script, err := FetchCatalog(ctx, *source)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FetchCatalog %s\n", err)
+		return 1
+	}
+
+	list, err := ParseCatalog(script)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ParseCatalog %s\n", err)
+		return 1
+	}
+
+	filename := cfg.Filename
+	content := defaultConfig
+
+	// The built-in configuration is copied to the user config directory.
+	if filename == builtinConfig {
+		filename = ConfigPaths()[1]
+	} else {
+		data, err := os.ReadFile(filename)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ReadFile %s\n", err)
+			return 1
+		}
+
+		content = string(data)
+	}
+
+	servers := MergeCatalog(cfg.Servers, list)
+	content = RewriteServers(content, servers)
+
+	if *dryRun {
+		fmt.Print(content)
+		return 0
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "MkdirAll %s\n", err)
+		return 1
+	}
+
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "WriteFile %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("%d testing servers written to %s\n", len(servers), filename)
+
+	return 0
+}
+
+// printServers prints the testing servers of the configuration.
+func printServers(cfg *Config) {
+	var icon string
+
+	fmt.Printf("    Testing servers from %s\n", cfg.Filename)
+	fmt.Println("    ┌─────────┬────────┬───────────────┬───────────────────┬────────────────────┐")
+	fmt.Println("    │ Server  │ Probe  │ Region        │ Coordinates       │ Location           │")
+	fmt.Println("┌───┼─────────┼────────┼───────────────┼───────────────────┼────────────────────┤")
+
+	for _, server := range cfg.Servers {
+		if server.Enabled {
+			icon = "\033[0;32m\u2714\033[0m"
+		} else {
+			icon = "\033[0;2m\u2718\033[0m"
+		}
+
+		prober := server.Prober
+
+		if prober == "" {
+			prober = defaultProber
+		}
+
+		fmt.Printf(
+			"│ %s │ \033[0;2m%s\033[0m │ %s │ %s │ %s │ %s │\n",
+			icon,
+			pad(server.ID, 7),
+			pad(prober, 6),
+			pad(server.Region, 13),
+			pad(fmt.Sprintf("%.3f, %.3f", server.Latitude, server.Longitude), 17),
+			pad(server.Title, 18),
+		)
+	}
+
+	fmt.Println("└───┴─────────┴────────┴───────────────┴───────────────────┴────────────────────┘")
+}
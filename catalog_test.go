@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCatalog(t *testing.T) {
+	script, err := os.ReadFile("testdata/loadtime-parser.js")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := ParseCatalog(string(script))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Server{
+		{ID: "8e84827", Title: "USA, Dallas", Enabled: true, Latitude: 32.7767, Longitude: -96.797},
+		{ID: "f1506d2", Title: "UK, London", Enabled: true, Latitude: 51.5074, Longitude: -0.1278},
+		{ID: "efae235", Title: "JP, Tokyo", Enabled: true, Latitude: 35.6762, Longitude: 139.6503},
+		{ID: "51bd240", Title: "Singapore", Enabled: true, Latitude: 1.3521, Longitude: 103.8198},
+		{ID: "198baae", Title: `Australia, "Sydney"`, Enabled: true, Latitude: -33.8688, Longitude: 151.2093},
+	}
+
+	if !reflect.DeepEqual(list, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, list)
+	}
+
+	if _, err := ParseCatalog("var settings = { animate: true };"); err == nil {
+		t.Fatal("expected an error without testing servers")
+	}
+}
+
+func TestMergeCatalog(t *testing.T) {
+	servers := []Server{
+		{ID: "8e84827", Title: "Dallas", Region: "north-america", Tags: []string{"us"}, Enabled: false},
+		{ID: "a1b2c3d", Title: "Office", Prober: "agent", Address: "http://10.0.0.5:8080/measure", Enabled: true},
+		{ID: "deadbee", Title: "Removed", Enabled: true},
+	}
+
+	list := []Server{
+		{ID: "f1506d2", Title: "UK, London", Enabled: true, Latitude: 51.5074, Longitude: -0.1278},
+		{ID: "8e84827", Title: "USA, Dallas", Enabled: true, Latitude: 32.7767, Longitude: -96.797},
+	}
+
+	expected := []Server{
+		list[0],
+		{ID: "8e84827", Title: "USA, Dallas", Region: "north-america", Tags: []string{"us"}, Enabled: false, Latitude: 32.7767, Longitude: -96.797},
+		servers[1],
+	}
+
+	if merged := MergeCatalog(servers, list); !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, merged)
+	}
+}
+
+func TestRewriteServers(t *testing.T) {
+	content := strings.Join([]string{
+		"; Testing servers, see webttfb servers update",
+		"",
+		"[defaults]",
+		"; samples = 1",
+		"sort = ttfb",
+		"",
+		"[server 8e84827]",
+		"title = Dallas",
+		"",
+		"[server deadbee]",
+		"title = Removed",
+		"",
+		"; [profile example.com]",
+		"[thresholds]",
+		"max-ttfb = 0.8",
+		"",
+	}, "\n")
+
+	servers := []Server{
+		{ID: "8e84827", Title: "USA, Dallas", Enabled: true, Latitude: 32.7767, Longitude: -96.797},
+		{ID: "a1b2c3d", Title: "Office", Prober: "agent", Address: "http://10.0.0.5:8080/measure", Enabled: true},
+	}
+
+	output := RewriteServers(content, servers)
+
+	for _, line := range []string{
+		"; Testing servers, see webttfb servers update\n",
+		"[defaults]\n; samples = 1\nsort = ttfb\n",
+		"; [profile example.com]\n[thresholds]\nmax-ttfb = 0.8\n",
+		"[server 8e84827]\ntitle = USA, Dallas\nlatitude = 32.7767\nlongitude = -96.797\n",
+		"[server a1b2c3d]\ntitle = Office\nprobe = agent\naddress = http://10.0.0.5:8080/measure\n",
+	} {
+		if !strings.Contains(output, line) {
+			t.Fatalf("expected %q in:\n%s", line, output)
+		}
+	}
+
+	if strings.Contains(output, "deadbee") || strings.Contains(output, "title = Dallas\n") {
+		t.Fatalf("expected the old servers to be replaced:\n%s", output)
+	}
+
+	cfg, err := ParseConfig(strings.NewReader(output), "webttfb.cfg")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Servers) != len(servers) {
+		t.Fatalf("expected %d servers, got %d:\n%s", len(servers), len(cfg.Servers), output)
+	}
+}
@@ -63,23 +63,54 @@ func (g Grade) bad() float64       { return 1.550 }
 func (g Grade) awful() float64     { return 1.950 }
 func (g Grade) worst() float64     { return 2.500 }
 
-// Paint builds the escape sequence to render the colors.
-func Paint(c Colorizer, value float64) string {
+// Level returns the name of the limit exceeded by the value, "danger",
+// "warning" or "success" if the value is below the successful limit, or an
+// empty string for the values in between.
+func Level(c Colorizer, value float64) string {
 	if value > c.danger() {
-		return fmt.Sprintf("\033[38;5;255;48;5;009m%.3f\033[0m", value)
+		return "danger"
 	}
 
 	if value > c.warning() {
-		return fmt.Sprintf("\033[38;5;008;48;5;226m%.3f\033[0m", value)
+		return "warning"
 	}
 
 	if value < c.success() {
+		return "success"
+	}
+
+	return ""
+}
+
+// Paint builds the escape sequence to render the colors.
+func Paint(c Colorizer, value float64) string {
+	switch Level(c, value) {
+	case "danger":
+		return fmt.Sprintf("\033[38;5;255;48;5;009m%.3f\033[0m", value)
+	case "warning":
+		return fmt.Sprintf("\033[38;5;008;48;5;226m%.3f\033[0m", value)
+	case "success":
 		return fmt.Sprintf("\033[38;5;255;48;5;034m%.3f\033[0m", value)
 	}
 
 	return fmt.Sprintf("%.3f", value)
 }
 
+// colorizer returns the limits of the timing group, or nil if the values of
+// the group are not colorized.
+func colorizer(group string) Colorizer {
+	switch group {
+	case connectionTime:
+		return ColorConn{}
+	case timeToFirstByte:
+		return ColorTTFB{}
+	case totalTime:
+		return ColorTTL{}
+	}
+
+	return nil
+}
+
 // Colorize returns the floating point with a background color.
 func Colorize(group string, value float64) string {
 	if value == 0.0 {
@@ -87,37 +118,40 @@ func Colorize(group string, value float64) string {
 		return fmt.Sprintf("%.3f", value)
 	}
 
-	if group == connectionTime {
-		return Paint(ColorConn{}, value)
-	}
-
-	if group == timeToFirstByte {
-		return Paint(ColorTTFB{}, value)
-	}
-
-	if group == totalTime {
-		return Paint(ColorTTL{}, value)
+	if c := colorizer(group); c != nil {
+		return Paint(c, value)
 	}
 
 	return fmt.Sprintf("%.3f", value)
 }
 
-// PerformanceGrade evaluates the average HTTP request total time through all
-// the testing servers and assigns a grade to the website's responsiveness. If
-// there were too many failures during the testing process the program defaults
-// to the worst grade.
-func PerformanceGrade(t *TTFB) string {
-	type score struct {
-		Grade string
-		Color string
-		Cond  bool
-	}
+// grades lists the possible grades from the best to the worst, the tilde is
+// assigned when the average total time is beyond the worst limit.
+var grades = []string{"A+", "A", "B", "C", "D", "E", "~", "F"}
 
+// score holds the grade assigned to the website and its color.
+type score struct {
+	Grade string
+	Color string
+	Cond  bool
+}
+
+// Score evaluates the average HTTP request total time through all the testing
+// servers and assigns a grade to the website's responsiveness. If there were
+// too many failures during the testing process the program defaults to the
+// worst grade. With multiple samples per location, the failures are the
+// locations without a single successful sample, so one flaky location does not
+// count once per failed sample.
+func Score(t *TTFB) score {
 	var g Grade
 	var level score
 	avg := t.Average(totalTime)
+	failures := len(t.Messages)
+	if t.Samples > 1 {
+		failures = t.FailedLocations()
+	}
 	scores := []score{
-		{Grade: "F", Color: "38;5;000;48;5;007m", Cond: len(t.Messages) > 4 || avg <= 0},
+		{Grade: "F", Color: "38;5;000;48;5;007m", Cond: failures > 4 || avg <= 0},
 		{Grade: "A+", Color: "38;5;255;48;5;038m", Cond: avg <= g.perfect()},
 		{Grade: "A", Color: "38;5;255;48;5;034m", Cond: avg <= g.excellent()},
 		{Grade: "B", Color: "38;5;008;48;5;226m", Cond: avg <= g.good()},
@@ -134,6 +168,26 @@ func PerformanceGrade(t *TTFB) string {
 		}
 	}
 
+	return level
+}
+
+// GradeRank returns the position of the grade in the list of grades, lower is
+// better, or -1 if the grade does not exist.
+func GradeRank(grade string) int {
+	for idx, item := range grades {
+		if item == grade {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// PerformanceGrade returns the grade assigned to the website with a background
+// color, see Score.
+func PerformanceGrade(t *TTFB) string {
+	level := Score(t)
+
 	return fmt.Sprintf(
 		"\033[%s Performance: %s \033[0m",
 		level.Color,
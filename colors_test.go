@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestPerformanceGradeSamples checks that the failed samples of one flaky
+// location do not count as multiple failures.
+func TestPerformanceGradeSamples(t *testing.T) {
+	tester := &TTFB{Samples: 5}
+
+	for i := 0; i < 6; i++ {
+		unique := fmt.Sprintf("s%02d", i)
+
+		for j := 0; j < tester.Samples; j++ {
+			data := Result{Status: 1}
+			data.Output.ServerID = unique
+			data.Output.TotalTime = 0.300
+
+			// The first location fails most of the time.
+			if i == 0 && j > 0 {
+				data = Result{}
+				data.Output.ServerID = unique
+				tester.Messages = append(tester.Messages, fmt.Errorf("%s: failed", unique))
+			}
+
+			tester.Results = append(tester.Results, data)
+		}
+	}
+
+	if grade := PerformanceGrade(tester); !strings.Contains(grade, "Performance: A+") {
+		t.Fatalf("expected A+, got %q", grade)
+	}
+
+	tester.Results = tester.Results[:0]
+
+	for i := 0; i < 5; i++ {
+		for j := 0; j < tester.Samples; j++ {
+			data := Result{}
+			data.Output.ServerID = fmt.Sprintf("s%02d", i)
+			tester.Results = append(tester.Results, data)
+		}
+	}
+
+	if grade := PerformanceGrade(tester); !strings.Contains(grade, "Performance: F") {
+		t.Fatalf("expected F, got %q", grade)
+	}
+}
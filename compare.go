@@ -0,0 +1,358 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// compareGroups lists the timing groups compared between the result sets.
+var compareGroups = []string{connectionTime, timeToFirstByte, totalTime}
+
+// Delta holds the change of one timing group of one location between the
+// result sets. The change is a percentage, positive values are slower.
+type Delta struct {
+	Group       string
+	Before      Stats
+	After       Stats
+	Change      float64
+	PValue      float64
+	Tested      bool
+	Significant bool
+}
+
+// Comparison holds the changes of one location between the result sets. The
+// failures are the number of failed tests added since the first result set,
+// and the location is missing if it was only tested in the first result set.
+type Comparison struct {
+	ServerID    string
+	ServerTitle string
+	Deltas      []Delta
+	Failures    int
+	Missing     bool
+	Regression  bool
+}
+
+// Compare returns the changes of each location between the result sets. A
+// location regresses when one of the timing groups is slower by more than the
+// threshold, which is a percentage, and the difference is significant at the
+// alpha level according to the Welch's t-test. Without enough samples to run
+// the test, the threshold alone decides. A location also regresses when more
+// tests failed than before, in which case there may be no timings to compare.
+// Locations that were not tested again are reported as missing.
+func Compare(before *TTFB, after *TTFB, threshold float64, alpha float64) []Comparison {
+	var order []string
+
+	index := make(map[string]*Comparison)
+
+	lookup := func(loc Location) *Comparison {
+		cmp, ok := index[loc.ServerID]
+
+		if !ok {
+			cmp = &Comparison{ServerID: loc.ServerID, ServerTitle: loc.ServerTitle}
+			index[loc.ServerID] = cmp
+			order = append(order, loc.ServerID)
+		}
+
+		return cmp
+	}
+
+	for _, group := range compareGroups {
+		old := make(map[string]Location)
+		tested := make(map[string]bool)
+
+		for _, loc := range before.Locations(group) {
+			old[loc.ServerID] = loc
+		}
+
+		for _, loc := range after.Locations(group) {
+			cmp := lookup(loc)
+			prev := old[loc.ServerID]
+			delta := Delta{Group: group, Before: prev.Stats, After: loc.Stats}
+			tested[loc.ServerID] = true
+
+			if delta.Before.Count > 0 && delta.After.Count > 0 {
+				delta.Change = (delta.After.Mean - delta.Before.Mean) / delta.Before.Mean * 100
+				delta.PValue, delta.Tested = WelchTest(delta.Before, delta.After)
+				delta.Significant = delta.Tested && delta.PValue < alpha
+			}
+
+			if delta.Change > threshold && (delta.Significant || !delta.Tested) {
+				cmp.Regression = true
+			}
+
+			if loc.Failures > prev.Failures {
+				cmp.Failures = loc.Failures - prev.Failures
+				cmp.Regression = true
+			}
+
+			cmp.Deltas = append(cmp.Deltas, delta)
+		}
+
+		for _, loc := range before.Locations(group) {
+			if tested[loc.ServerID] {
+				continue
+			}
+
+			cmp := lookup(loc)
+			cmp.Missing = true
+			cmp.Deltas = append(cmp.Deltas, Delta{Group: group, Before: loc.Stats})
+		}
+	}
+
+	list := make([]Comparison, 0, len(order))
+
+	for _, unique := range order {
+		list = append(list, *index[unique])
+	}
+
+	return list
+}
+
+// loadSource returns the results of the website from a file printed with
+// "-json", or from the history file if the source is "history:N", where N is
+// the position of the run, negative positions count from the last run.
+func loadSource(source string, domain string, history string) (*TTFB, error) {
+	if strings.HasPrefix(source, "history:") {
+		pos, err := strconv.Atoi(source[8:])
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid history position %q", source)
+		}
+
+		runs, err := LoadHistory(history, domain)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if pos < 0 {
+			pos += len(runs)
+		}
+
+		if pos < 0 || pos >= len(runs) {
+			return nil, fmt.Errorf("%s: there are %d runs for %s", source, len(runs), domain)
+		}
+
+		return &TTFB{Domain: domain, Results: runs[pos].Results}, nil
+	}
+
+	results, err := LoadResults(source)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if list, ok := results[""]; ok {
+		return &TTFB{Domain: domain, Results: list}, nil
+	}
+
+	if list, ok := results[domain]; ok {
+		return &TTFB{Domain: domain, Results: list}, nil
+	}
+
+	// Batch files with one website do not require the domain name.
+	if len(results) == 1 {
+		for name, list := range results {
+			return &TTFB{Domain: name, Results: list}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: there are no results for %s", source, domain)
+}
+
+// compareCommand prints the changes between two result sets, either files
+// printed with "-json" or runs from the history file, by default the last two
+// runs. The exit code is 3 if at least one location, the average total time or
+// the performance grade regressed, or if more tests failed than before, which
+// allows to fail a deployment pipeline.
+func compareCommand(args []string) int {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	domain := flags.String("d", "example.com", "Domain name to be compared")
+	threshold := flags.Float64("threshold", 10, "Percentage of slowdown considered a regression")
+	alpha := flags.Float64("alpha", 0.05, "Significance level of the Welch's t-test")
+	filename := flags.String("file", HistoryPath(), "Location of the history file")
+
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: webttfb compare [flags] [before after]")
+		fmt.Fprintln(os.Stderr, "  Sources are files printed with -json or history:N, default history:-2 history:-1")
+		fmt.Fprintln(os.Stderr, "  Exit code 3 means that at least one timing or the grade regressed, or more tests failed")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	sources := flags.Args()
+
+	if len(sources) == 0 {
+		sources = []string{"history:-2", "history:-1"}
+	}
+
+	if len(sources) != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	before, err := loadSource(sources[0], *domain, *filename)
+
+	if err == nil && len(before.Results) == 0 {
+		err = errors.New(sources[0] + ": there are no results")
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare %s\n", err)
+		return 1
+	}
+
+	after, err := loadSource(sources[1], *domain, *filename)
+
+	if err == nil && len(after.Results) == 0 {
+		err = errors.New(sources[1] + ": there are no results")
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "compare %s\n", err)
+		return 1
+	}
+
+	var icon string
+	var regressions int
+	var failures int
+	var missing int
+
+	comparisons := Compare(before, after, *threshold, *alpha)
+
+	fmt.Printf("    %s compared to %s\n", sources[1], sources[0])
+	fmt.Println("    " + rule("┌", "┬", "┐", 6))
+	fmt.Println("    │ Server  │ Conn  │ TTFB  │ Old   │ TTL   │ Diff  │ p     │ Location           │")
+	fmt.Println("┌───" + rule("┼", "┼", "┤", 6))
+
+	for _, cmp := range comparisons {
+		ttl := cmp.Deltas[len(cmp.Deltas)-1]
+
+		diff := percentChange(ttl)
+
+		if cmp.Failures > 0 {
+			failures++
+			diff = "fail"
+		}
+
+		switch {
+		case cmp.Missing:
+			missing++
+			diff = "n/a"
+			icon = "\033[0;2m?\033[0m"
+		case cmp.Regression:
+			regressions++
+			icon = "\033[0;31m\u25B2\033[0m"
+		case ttl.Before.Count == 0 || ttl.After.Count == 0:
+			icon = "\033[0;2m?\033[0m"
+		default:
+			icon = "\033[0;32m\u2714\033[0m"
+		}
+
+		pvalue := "-"
+
+		if ttl.Tested {
+			pvalue = fmt.Sprintf("%.3f", ttl.PValue)
+		}
+
+		fmt.Printf(
+			"│ %s │ \033[0;2m%s\033[0m │ %s │ %s │ %.3f │ %s │ %s │ %s │ %s │\n",
+			icon,
+			cmp.ServerID,
+			pad(percentChange(cmp.Deltas[0]), 5),
+			pad(percentChange(cmp.Deltas[1]), 5),
+			ttl.Before.Mean,
+			Colorize(totalTime, ttl.After.Mean),
+			pad(diff, 5),
+			pad(pvalue, 5),
+			pad(cmp.ServerTitle, 18),
+		)
+	}
+
+	oldAvg := before.SuccessfulAverage(totalTime)
+	newAvg := after.SuccessfulAverage(totalTime)
+	avgChange := 0.0
+
+	if oldAvg > 0 {
+		avgChange = (newAvg - oldAvg) / oldAvg * 100
+	}
+
+	fmt.Println("└───" + rule("┼", "┼", "┤", 6))
+	fmt.Printf(
+		"    │ Average │ %s │ %s │ %.3f │ %.3f │ %s │       │ %s │\n",
+		pad(averageChange(before, after, connectionTime), 5),
+		pad(averageChange(before, after, timeToFirstByte), 5),
+		oldAvg,
+		newAvg,
+		pad(averageChange(before, after, totalTime), 5),
+		pad(fmt.Sprintf("Grade %s to %s", Score(before).Grade, Score(after).Grade), 18),
+	)
+	fmt.Println("    " + rule("└", "┴", "┘", 6))
+
+	if regressions > 0 {
+		fmt.Printf("\033[0;31m\u2022\033[0m %d location(s) regressed more than %.0f%% or failed\n", regressions, *threshold)
+	}
+
+	if failures > 0 {
+		fmt.Printf("\033[0;31m\u2022\033[0m %d location(s) failed more tests than before\n", failures)
+	}
+
+	if missing > 0 {
+		fmt.Printf("\033[0;2m\u2022\033[0m %d location(s) were not tested in %s\n", missing, sources[1])
+	}
+
+	if avgChange > *threshold {
+		regressions++
+		fmt.Printf("\033[0;31m\u2022\033[0m average total time regressed %.0f%%\n", avgChange)
+	}
+
+	if GradeRank(Score(after).Grade) > GradeRank(Score(before).Grade) {
+		regressions++
+		fmt.Printf("\033[0;31m\u2022\033[0m performance grade dropped from %s to %s\n", Score(before).Grade, Score(after).Grade)
+	}
+
+	if regressions > 0 {
+		return 3
+	}
+
+	return 0
+}
+
+// percentChange returns the change of the mean as a signed percentage.
+func percentChange(delta Delta) string {
+	if delta.Before.Count == 0 || delta.After.Count == 0 {
+		return "-"
+	}
+
+	return formatChange(delta.Change)
+}
+
+// averageChange returns the change of the average of the timing group, only
+// the successful tests are included, see TTFB.SuccessfulAverage.
+func averageChange(before *TTFB, after *TTFB, group string) string {
+	old := before.SuccessfulAverage(group)
+	now := after.SuccessfulAverage(group)
+
+	if old == 0 || now == 0 {
+		return "-"
+	}
+
+	return formatChange((now - old) / old * 100)
+}
+
+// formatChange returns the percentage with a sign, or the ratio between the
+// values if the percentage does not fit in the column.
+func formatChange(change float64) string {
+	if change >= 1000 {
+		return fmt.Sprintf("%.0fx", change/100+1)
+	}
+
+	return fmt.Sprintf("%+.0f%%", change)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+// comparedResult returns the result of one test from the server, a zero total
+// time means that the test failed.
+func comparedResult(unique string, ttl float64) Result {
+	data := Result{Status: 1}
+
+	if ttl == 0 {
+		data.Status = 0
+	}
+
+	data.Output.ServerID = unique
+	data.Output.ServerTitle = "Server " + unique
+	data.Output.ConnectTime = ttl / 4
+	data.Output.FirstByteTime = ttl / 2
+	data.Output.TotalTime = ttl
+
+	return data
+}
+
+// TestCompareFailures checks that new failures are regressions and that the
+// locations tested only in the first result set are reported as missing.
+func TestCompareFailures(t *testing.T) {
+	before := &TTFB{Results: []Result{
+		comparedResult("a1", 0.400),
+		comparedResult("b2", 0.400),
+		comparedResult("c3", 0.400),
+	}}
+
+	after := &TTFB{Results: []Result{
+		comparedResult("a1", 0.400),
+		comparedResult("b2", 0),
+	}}
+
+	found := make(map[string]Comparison)
+
+	for _, cmp := range Compare(before, after, 10, 0.05) {
+		found[cmp.ServerID] = cmp
+	}
+
+	if cmp := found["a1"]; cmp.Regression || cmp.Missing {
+		t.Fatalf("expected a1 unchanged, got %+v", cmp)
+	}
+
+	if cmp := found["b2"]; !cmp.Regression || cmp.Failures != 1 {
+		t.Fatalf("expected b2 to regress with one failure, got %+v", cmp)
+	}
+
+	if cmp := found["c3"]; !cmp.Missing || len(cmp.Deltas) != len(compareGroups) {
+		t.Fatalf("expected c3 missing with all the groups, got %+v", cmp)
+	}
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config holds the content of the configuration file. The file uses the INI
+// format with the following sections, all of them optional:
+//
+//	[defaults]            default values for the command line flags
+//	[thresholds]          budgets, e.g. "max-ttfb = 0.8"
+//	[output]              output preferences, e.g. "sort = ttfb"
+//	[profile <name>]      flags applied when "-d" matches "domain = <name>"
+//	[server <id>]         one testing server, see Server
+//
+// Lines with the old "id: location" format are accepted at the beginning of the
+// file or inside a "[servers]" section, the prober and the address of a server
+// are only available in the "[server <id>]" section.
+type Config struct {
+	Filename   string
+	Servers    []Server
+	Defaults   []Option
+	Thresholds []Option
+	Output     []Option
+	Profiles   []Profile
+}
+
+// Option holds one "key = value" line and its position in the file.
+type Option struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// Profile holds the flags applied to one domain name.
+type Profile struct {
+	Name    string
+	Domain  string
+	Options []Option
+}
+
+// flagAliases maps the readable names accepted in the configuration file to
+// the names of the command line flags.
+var flagAliases = map[string]string{
+	"domain":  "d",
+	"sort":    "s",
+	"private": "p",
+	"local":   "l",
+	"samples": "n",
+}
+
+// thresholdKeys lists the flags accepted in the thresholds section.
+var thresholdKeys = map[string]bool{
+	budgetAverage:  true,
+	budgetLocation: true,
+	budgetGrade:    true,
+	budgetFailures: true,
+}
+
+// outputKeys lists the flags accepted in the output section.
+var outputKeys = map[string]bool{
+	"s":             true,
+	"json":          true,
+	"format":        true,
+	"history":       true,
+	"budget-report": true,
+}
+
+// projectKeys lists the flags that the configuration file in the project
+// directory cannot set. The file comes with the repository, usually written by
+// somebody else, and these flags decide where the program writes files.
+var projectKeys = map[string]bool{
+	"history":       true,
+	"budget-report": true,
+}
+
+// defaultConfig holds the configuration shipped with the program, which is
+// used when there is no configuration file in any of the known locations.
+//
+//go:embed webttfb.cfg
+var defaultConfig string
+
+// ConfigPaths returns the locations where the configuration file is searched,
+// from the highest to the lowest priority: the project directory, the config
+// directory defined by the XDG Base Directory specification and the home
+// directory.
+//
+// @ref: https://specifications.freedesktop.org/basedir-spec/latest/
+func ConfigPaths() []string {
+	home := os.Getenv("HOME")
+	dir := os.Getenv("XDG_CONFIG_HOME")
+
+	if dir == "" {
+		dir = filepath.Join(home, ".config")
+	}
+
+	return []string{
+		config,
+		filepath.Join(dir, "webttfb", "webttfb.cfg"),
+		filepath.Join(home, config),
+	}
+}
+
+// FindConfig loads the configuration file specified with the flag or with the
+// WEBTTFB_CONFIG environment variable, which must exist, otherwise the first
+// file found in ConfigPaths. The built-in server list is used if there is no
+// configuration file. The file in the project directory cannot set the flags
+// in projectKeys, they are only honored from the other locations.
+func FindConfig(filename string) (*Config, error) {
+	if filename == "" {
+		filename = os.Getenv("WEBTTFB_CONFIG")
+	}
+
+	if filename != "" {
+		return LoadConfig(filename)
+	}
+
+	for _, candidate := range ConfigPaths() {
+		cfg, err := LoadConfig(candidate)
+
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err == nil && candidate == config {
+			err = cfg.checkProject()
+		}
+
+		return cfg, err
+	}
+
+	return ParseConfig(strings.NewReader(defaultConfig), builtinConfig)
+}
+
+// checkProject returns an error if the configuration sets any of the flags in
+// projectKeys, which are not accepted in the project directory.
+func (c *Config) checkProject() error {
+	options := append([]Option{}, c.Defaults...)
+	options = append(options, c.Output...)
+
+	for _, profile := range c.Profiles {
+		options = append(options, profile.Options...)
+	}
+
+	for _, opt := range options {
+		if projectKeys[opt.Key] {
+			return configError(c.Filename, opt.Line, "%q is only accepted with -config, $WEBTTFB_CONFIG or in the user configuration", opt.Key)
+		}
+	}
+
+	return nil
+}
+
+// configError describes a problem in one line of the configuration file.
+func configError(filename string, line int, format string, a ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", filename, line, fmt.Sprintf(format, a...))
+}
+
+// LoadConfig reads and parses the configuration file.
+func LoadConfig(filename string) (*Config, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Println("file.Close", err)
+		}
+	}()
+
+	return ParseConfig(file, filename)
+}
+
+// ParseConfig parses the configuration from the reader, the filename is only
+// used to describe the errors.
+func ParseConfig(r io.Reader, filename string) (*Config, error) {
+	var lineno int
+	var section string
+	var server *Server
+	var profile *Profile
+
+	cfg := &Config{Filename: filename}
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip comments using .ini file format.
+		if line == "" || line[0:1] == ";" || line[0:1] == "#" {
+			continue
+		}
+
+		if line[0:1] == "[" {
+			if line[len(line)-1:] != "]" {
+				return nil, configError(filename, lineno, "section is not closed")
+			}
+
+			fields := strings.Fields(line[1 : len(line)-1])
+
+			if len(fields) == 0 {
+				return nil, configError(filename, lineno, "section without name")
+			}
+
+			section = fields[0]
+			name := strings.Join(fields[1:], "\x20")
+			server = nil
+			profile = nil
+
+			switch section {
+			case "defaults", "thresholds", "output", "servers":
+				if name != "" {
+					return nil, configError(filename, lineno, "section %q does not accept a name", section)
+				}
+			case "server":
+				if name == "" {
+					return nil, configError(filename, lineno, "server without identifier")
+				}
+				if prev, ok := seen[name]; ok {
+					return nil, configError(filename, lineno, "server %q already defined in line %d", name, prev)
+				}
+				seen[name] = lineno
+				cfg.Servers = append(cfg.Servers, Server{ID: name, Enabled: true})
+				server = &cfg.Servers[len(cfg.Servers)-1]
+			case "profile":
+				if name == "" {
+					return nil, configError(filename, lineno, "profile without name")
+				}
+				cfg.Profiles = append(cfg.Profiles, Profile{Name: name, Domain: name})
+				profile = &cfg.Profiles[len(cfg.Profiles)-1]
+			default:
+				return nil, configError(filename, lineno, "unknown section %q", section)
+			}
+
+			continue
+		}
+
+		if section == "" || section == "servers" {
+			entry, err := parseServerLine(line)
+
+			if err != nil {
+				return nil, configError(filename, lineno, "%s", err)
+			}
+
+			// Append non-duplicated servers to the list.
+			if _, ok := seen[entry.ID]; !ok {
+				seen[entry.ID] = lineno
+				cfg.Servers = append(cfg.Servers, entry)
+			}
+
+			continue
+		}
+
+		idx := strings.Index(line, "=")
+
+		if idx < 0 {
+			return nil, configError(filename, lineno, "expected \"key = value\"")
+		}
+
+		opt := Option{
+			Key:   strings.TrimSpace(line[:idx]),
+			Value: strings.TrimSpace(line[idx+1:]),
+			Line:  lineno,
+		}
+
+		if alias, ok := flagAliases[opt.Key]; ok {
+			opt.Key = alias
+		}
+
+		switch section {
+		case "defaults":
+			cfg.Defaults = append(cfg.Defaults, opt)
+		case "thresholds":
+			if !thresholdKeys[opt.Key] {
+				return nil, configError(filename, lineno, "unknown threshold %q", opt.Key)
+			}
+			cfg.Thresholds = append(cfg.Thresholds, opt)
+		case "output":
+			if !outputKeys[opt.Key] {
+				return nil, configError(filename, lineno, "unknown output option %q", opt.Key)
+			}
+			cfg.Output = append(cfg.Output, opt)
+		case "profile":
+			if opt.Key == "d" {
+				profile.Domain = opt.Value
+				continue
+			}
+			profile.Options = append(profile.Options, opt)
+		case "server":
+			if err := server.Set(opt.Key, opt.Value); err != nil {
+				return nil, configError(filename, lineno, "%s", err)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// parseServerLine parses one server using the old format, for example:
+//
+//	8e84827: USA, Dallas
+func parseServerLine(line string) (Server, error) {
+	idx := strings.Index(line, ":")
+
+	if idx <= 0 {
+		return Server{}, fmt.Errorf("expected \"id: location\"")
+	}
+
+	entry := Server{
+		ID:      strings.TrimSpace(line[:idx]),
+		Title:   strings.TrimSpace(line[idx+1:]),
+		Enabled: true,
+	}
+
+	if entry.Title == "" {
+		return entry, fmt.Errorf("server %q without location", entry.ID)
+	}
+
+	return entry, nil
+}
+
+// Set assigns the value of one key of the server section.
+func (s *Server) Set(key string, value string) error {
+	var err error
+
+	switch key {
+	case "title":
+		s.Title = value
+	case "enabled":
+		s.Enabled, err = strconv.ParseBool(value)
+	case "tags":
+		s.Tags = splitList(value)
+	case "region":
+		s.Region = value
+	case "probe", "prober":
+		_, err = LookupProber(value)
+		s.Prober = value
+	case "address":
+		s.Address = value
+	case "latitude":
+		s.Latitude, err = strconv.ParseFloat(value, 64)
+	case "longitude":
+		s.Longitude, err = strconv.ParseFloat(value, 64)
+	default:
+		return fmt.Errorf("unknown server option %q", key)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %s", key, value, unwrapNumError(err))
+	}
+
+	return nil
+}
+
+// Matches reports whether the server is selected by the pattern, which is
+// either the identifier of the server, one of its tags, its region or part of
+// its title. The comparison is not case-sensitive.
+func (s Server) Matches(pattern string) bool {
+	if pattern == s.ID || strings.EqualFold(pattern, s.Region) {
+		return true
+	}
+
+	for _, tag := range s.Tags {
+		if strings.EqualFold(pattern, tag) {
+			return true
+		}
+	}
+
+	return strings.Contains(strings.ToLower(s.Title), strings.ToLower(pattern))
+}
+
+// splitList returns the non-empty values of a comma-separated list.
+func splitList(value string) []string {
+	var list []string
+
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+// unwrapNumError removes the name of the function from the errors returned by
+// the strconv package, which is not useful for the user.
+func unwrapNumError(err error) error {
+	if e, ok := err.(*strconv.NumError); ok {
+		return e.Err
+	}
+
+	return err
+}
+
+// Filter keeps the servers that match at least one of the included patterns,
+// or all of them if there are no included patterns, and removes the servers
+// that match any of the excluded patterns.
+func (c *Config) Filter(include []string, exclude []string) error {
+	var kept []Server
+
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil
+	}
+
+	for _, server := range c.Servers {
+		if len(include) > 0 && !matchesAny(server, include) {
+			continue
+		}
+
+		if matchesAny(server, exclude) {
+			continue
+		}
+
+		kept = append(kept, server)
+	}
+
+	if len(kept) == 0 {
+		return errors.New("no testing server matches the filters")
+	}
+
+	c.Servers = kept
+
+	return nil
+}
+
+// matchesAny reports whether the server matches one of the patterns.
+func matchesAny(server Server, patterns []string) bool {
+	for _, pattern := range patterns {
+		if server.Matches(pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Profile returns the profile with the name, or the first profile for the
+// domain name if the name is empty, or nil if there is no profile.
+func (c *Config) Profile(name string, domain string) *Profile {
+	for idx, profile := range c.Profiles {
+		if name != "" && profile.Name == name {
+			return &c.Profiles[idx]
+		}
+
+		if name == "" && profile.Domain == domain {
+			return &c.Profiles[idx]
+		}
+	}
+
+	return nil
+}
+
+// Apply sets the flags that were not specified in the command line with the
+// values of the configuration file. The options of the profile take priority
+// over the default values, the thresholds and the output preferences.
+func (c *Config) Apply(fs *flag.FlagSet, profile *Profile) error {
+	set := make(map[string]bool)
+
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var options []Option
+
+	if profile != nil {
+		options = append(options, profile.Options...)
+	}
+
+	options = append(options, c.Defaults...)
+	options = append(options, c.Thresholds...)
+	options = append(options, c.Output...)
+
+	for _, opt := range options {
+		if set[opt.Key] {
+			continue
+		}
+
+		if fs.Lookup(opt.Key) == nil {
+			return configError(c.Filename, opt.Line, "unknown flag %q", opt.Key)
+		}
+
+		if err := fs.Set(opt.Key, opt.Value); err != nil {
+			return configError(c.Filename, opt.Line, "%s: %s", opt.Key, err)
+		}
+
+		set[opt.Key] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `; comment
+8e84827: USA, Dallas
+f1506d2: UK, London
+
+[defaults]
+samples = 3
+sort = ttfb
+
+[thresholds]
+max-ttfb = 0.8
+
+[profile slow]
+domain = example.org
+samples = 5
+max-ttfb = 2
+
+[server a1b2c3d]
+title = USA, Oregon
+probe = agent
+address = http://10.0.0.5:8080/measure
+tags = us, west
+`
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(testConfig), "test.cfg")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cfg.Servers) != 3 {
+		t.Fatalf("expected 3 servers, got %d", len(cfg.Servers))
+	}
+
+	if s := cfg.Servers[0]; s.ID != "8e84827" || s.Title != "USA, Dallas" || !s.Enabled {
+		t.Fatalf("unexpected legacy server %#v", s)
+	}
+
+	s := cfg.Servers[2]
+
+	if s.ID != "a1b2c3d" || s.Prober != "agent" || s.Address != "http://10.0.0.5:8080/measure" {
+		t.Fatalf("unexpected agent server %#v", s)
+	}
+
+	if len(s.Tags) != 2 || s.Tags[0] != "us" || s.Tags[1] != "west" {
+		t.Fatalf("unexpected tags %q", s.Tags)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := map[string]string{
+		"8e84827: USA, Dallas\n[server 8e84827]\ntitle = Dallas":    `test.cfg:2: server "8e84827" already defined in line 1`,
+		"[server a1]\ntitle = A\n\n[server a1]\ntitle = B":          `test.cfg:4: server "a1" already defined in line 1`,
+		"[servers]\n8e84827 USA, Dallas":                            `test.cfg:2: expected "id: location"`,
+		"8e84827:\x20":                                              `test.cfg:1: server "8e84827" without location`,
+		"\n[unknown]":                                               `test.cfg:2: unknown section "unknown"`,
+		"[defaults\nsamples = 1":                                    `test.cfg:1: section is not closed`,
+		"[defaults]\nsamples":                                       `test.cfg:2: expected "key = value"`,
+		"[thresholds]\n\nmax-speed = 1":                             `test.cfg:3: unknown threshold "max-speed"`,
+		"[output]\ncolor = true":                                    `test.cfg:2: unknown output option "color"`,
+		"[server a1]\ncolour = red":                                 `test.cfg:2: unknown server option "colour"`,
+		"[server a1]\nlatitude = north":                             `test.cfg:2: invalid latitude "north": invalid syntax`,
+		"[server a1]\nprobe = carrier-pigeon":                       `test.cfg:2: invalid probe "carrier-pigeon": unknown prober "carrier-pigeon", available: ` + ProberNames(),
+		"[server]\ntitle = A":                                       `test.cfg:1: server without identifier`,
+		"8e84827: USA, Dallas | agent http://10.0.0.5:8080/measure": "",
+	}
+
+	for input, expected := range tests {
+		cfg, err := ParseConfig(strings.NewReader(input), "test.cfg")
+
+		if expected == "" {
+			// The prober and the address are only accepted in the server
+			// section, the old format keeps everything as the location.
+			if err != nil || cfg.Servers[0].Prober != "" || cfg.Servers[0].Address != "" {
+				t.Fatalf("unexpected result for %q: %#v, %v", input, cfg, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != expected {
+			t.Fatalf("expected %q for %q, got %v", expected, input, err)
+		}
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	cfg, err := ParseConfig(strings.NewReader(testConfig), "test.cfg")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newFlags := func(args ...string) *flag.FlagSet {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("d", "example.com", "")
+		fs.String("s", "status", "")
+		fs.Int("n", 1, "")
+		fs.Float64(budgetAverage, 0, "")
+
+		if err := fs.Parse(args); err != nil {
+			t.Fatal(err)
+		}
+
+		return fs
+	}
+
+	tests := []struct {
+		args     []string
+		profile  *Profile
+		expected map[string]string
+	}{
+		{nil, nil, map[string]string{"n": "3", "s": "ttfb", budgetAverage: "0.8"}},
+		{nil, cfg.Profile("", "example.org"), map[string]string{"n": "5", "s": "ttfb", budgetAverage: "2"}},
+		{[]string{"-n", "7"}, cfg.Profile("slow", ""), map[string]string{"n": "7", "s": "ttfb", budgetAverage: "2"}},
+	}
+
+	for _, test := range tests {
+		fs := newFlags(test.args...)
+
+		if err := cfg.Apply(fs, test.profile); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, value := range test.expected {
+			if actual := fs.Lookup(name).Value.String(); actual != value {
+				t.Fatalf("expected %s=%s with %q, got %s", name, value, test.args, actual)
+			}
+		}
+	}
+
+	if cfg.Profile("", "example.com") != nil {
+		t.Fatal("unexpected profile for example.com")
+	}
+
+	err = cfg.Apply(flag.NewFlagSet("empty", flag.ContinueOnError), nil)
+
+	if err == nil || err.Error() != `test.cfg:6: unknown flag "n"` {
+		t.Fatalf("expected unknown flag error, got %v", err)
+	}
+}
+
+// setenv changes the environment variable until the end of the test.
+func setenv(t *testing.T, key string, value string) {
+	t.Helper()
+
+	old, ok := os.LookupEnv(key)
+
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+}
+
+// writeConfig creates the configuration file with one server titled after the
+// location, so the tests can tell which file was loaded.
+func writeConfig(t *testing.T, filename string, title string, extra string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	content := "[server a1]\ntitle = " + title + "\n" + extra
+
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	project := filepath.Join(dir, "project")
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(project); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	setenv(t, "HOME", home)
+	setenv(t, "XDG_CONFIG_HOME", "")
+	setenv(t, "WEBTTFB_CONFIG", "")
+
+	find := func(filename string) string {
+		t.Helper()
+
+		cfg, err := FindConfig(filename)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cfg.Filename == "built-in webttfb.cfg" {
+			return "built-in"
+		}
+
+		return cfg.Servers[0].Title
+	}
+
+	if title := find(""); title != "built-in" {
+		t.Fatalf("expected the built-in configuration, got %s", title)
+	}
+
+	writeConfig(t, filepath.Join(home, config), "home", "")
+
+	if title := find(""); title != "home" {
+		t.Fatalf("expected the home configuration, got %s", title)
+	}
+
+	writeConfig(t, filepath.Join(home, ".config", "webttfb", "webttfb.cfg"), "xdg", "[output]\nhistory = /tmp/history.jsonl\n")
+
+	if title := find(""); title != "xdg" {
+		t.Fatalf("expected the XDG configuration, got %s", title)
+	}
+
+	writeConfig(t, config, "project", "")
+
+	if title := find(""); title != "project" {
+		t.Fatalf("expected the project configuration, got %s", title)
+	}
+
+	writeConfig(t, filepath.Join(dir, "env.cfg"), "env", "")
+	setenv(t, "WEBTTFB_CONFIG", filepath.Join(dir, "env.cfg"))
+
+	if title := find(""); title != "env" {
+		t.Fatalf("expected the configuration in the environment, got %s", title)
+	}
+
+	writeConfig(t, filepath.Join(dir, "flag.cfg"), "flag", "")
+
+	if title := find(filepath.Join(dir, "flag.cfg")); title != "flag" {
+		t.Fatalf("expected the configuration in the flag, got %s", title)
+	}
+
+	setenv(t, "WEBTTFB_CONFIG", filepath.Join(dir, "missing.cfg"))
+
+	if _, err := FindConfig(""); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected an error for the missing file, got %v", err)
+	}
+}
+
+func TestFindConfigProject(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	setenv(t, "HOME", filepath.Join(dir, "home"))
+	setenv(t, "XDG_CONFIG_HOME", "")
+	setenv(t, "WEBTTFB_CONFIG", "")
+
+	for _, extra := range []string{
+		"[output]\nhistory = /tmp/history.jsonl\n",
+		"[defaults]\nbudget-report = /tmp/report.json\n",
+		"[profile example.com]\nhistory = /tmp/history.jsonl\n",
+	} {
+		writeConfig(t, config, "project", extra)
+
+		if _, err := FindConfig(""); err == nil || !strings.Contains(err.Error(), "is only accepted with -config") {
+			t.Fatalf("expected an error for %q, got %v", extra, err)
+		}
+	}
+
+	// The same file is trusted when it is specified explicitly.
+	cfg, err := FindConfig(config)
+
+	if err != nil || len(cfg.Profiles) != 1 {
+		t.Fatalf("expected the explicit configuration, got %v", err)
+	}
+}
+
+func TestServerMatches(t *testing.T) {
+	server := Server{ID: "8e84827", Title: "USA, Dallas", Region: "north-america", Tags: []string{"us", "Texas"}}
+
+	tests := map[string]bool{
+		"8e84827":       true,
+		"8E84827":       false,
+		"North-America": true,
+		"texas":         true,
+		"dallas":        true,
+		"usa, d":        true,
+		"europe":        false,
+		"8e8":           false,
+	}
+
+	for pattern, expected := range tests {
+		if server.Matches(pattern) != expected {
+			t.Fatalf("expected %v for %q", expected, pattern)
+		}
+	}
+}
+
+func TestConfigFilter(t *testing.T) {
+	servers := []Server{
+		{ID: "8e84827", Title: "USA, Dallas", Region: "north-america", Tags: []string{"us"}},
+		{ID: "355689c", Title: "USA, Los Angeles", Region: "north-america", Tags: []string{"us"}},
+		{ID: "f1506d2", Title: "UK, London", Region: "europe"},
+		{ID: "efae235", Title: "JP, Tokyo", Region: "asia"},
+	}
+
+	ids := func(list []Server) string {
+		var out []string
+
+		for _, server := range list {
+			out = append(out, server.ID)
+		}
+
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		include  []string
+		exclude  []string
+		expected string
+	}{
+		{nil, nil, "8e84827,355689c,f1506d2,efae235"},
+		{[]string{"us"}, nil, "8e84827,355689c"},
+		{[]string{"us", "asia"}, nil, "8e84827,355689c,efae235"},
+		{nil, []string{"north-america"}, "f1506d2,efae235"},
+		{[]string{"us"}, []string{"dallas"}, "355689c"},
+		{[]string{"europe"}, []string{"f1506d2"}, ""},
+	}
+
+	for _, test := range tests {
+		cfg := &Config{Servers: append([]Server{}, servers...)}
+		err := cfg.Filter(test.include, test.exclude)
+
+		if test.expected == "" {
+			if err == nil {
+				t.Fatalf("expected an error for %q and %q", test.include, test.exclude)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := ids(cfg.Servers); actual != test.expected {
+			t.Fatalf("expected %s for %q and %q, got %s", test.expected, test.include, test.exclude, actual)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buckets defines the upper bounds of the histograms, the values include the
+// limits used to colorize the connection time, the time to first byte and the
+// total time, so the histograms align with the colors of the table.
+var buckets = []float64{0.1, 0.18, 0.25, 0.4, 0.55, 0.7, 0.99, 1.15, 1.28, 1.45, 2, 2.5, 5, 10}
+
+// series defines the timing groups exported as metrics and their names.
+var series = []struct {
+	Group string
+	Name  string
+	Help  string
+}{
+	{connectionTime, "connect", "Connection time"},
+	{timeToFirstByte, "ttfb", "Time to first byte"},
+	{totalTime, "total", "Total time"},
+}
+
+// histogram holds the cumulative observations of one timing group.
+type histogram struct {
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// observe adds the value to the histogram.
+func (h *histogram) observe(value float64) {
+	if h.Counts == nil {
+		h.Counts = make([]uint64, len(buckets))
+	}
+
+	for idx, bound := range buckets {
+		if value <= bound {
+			h.Counts[idx]++
+		}
+	}
+
+	h.Count++
+	h.Sum += value
+}
+
+// Exporter tests the websites periodically and exposes the results with the
+// Prometheus text-based format, so the results can be scraped into existing
+// dashboards. Every metric is labeled by domain name and testing server.
+//
+// @ref: https://prometheus.io/docs/instrumenting/exposition_formats/
+type Exporter struct {
+	sync.Mutex
+	gauges     map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+	failures   map[string]float64
+	errors     map[string]float64
+	runs       map[string]float64
+	lastRun    map[string]float64
+}
+
+// NewExporter returns a new pointer to the Exporter object.
+func NewExporter() *Exporter {
+	e := &Exporter{
+		gauges:     make(map[string]map[string]float64),
+		histograms: make(map[string]map[string]*histogram),
+		failures:   make(map[string]float64),
+		errors:     make(map[string]float64),
+		runs:       make(map[string]float64),
+		lastRun:    make(map[string]float64),
+	}
+
+	for _, item := range series {
+		e.gauges[item.Name] = make(map[string]float64)
+		e.histograms[item.Name] = make(map[string]*histogram)
+	}
+
+	return e
+}
+
+// Collect updates the metrics with the results of the website.
+func (e *Exporter) Collect(t *TTFB, when time.Time) {
+	e.Lock()
+	defer e.Unlock()
+
+	domain := labels("domain", t.Domain)
+
+	e.runs[domain]++
+	e.lastRun[domain] = float64(when.Unix())
+
+	for _, message := range t.Messages {
+		var perr *ProbeError
+
+		if errors.As(message, &perr) {
+			e.errors[labels("domain", t.Domain, "server_id", perr.ServerID)]++
+		} else {
+			e.errors[domain]++
+		}
+	}
+
+	for _, data := range t.Results {
+		location := labels(
+			"domain", t.Domain,
+			"server_id", data.Output.ServerID,
+			"server_title", stableTitle(data),
+		)
+
+		if data.Status != 1 {
+			e.failures[location]++
+			continue
+		}
+
+		// Make sure the counter exists even without failures.
+		e.failures[location] += 0
+
+		for _, item := range series {
+			value, _ := data.Output.Metric(item.Group)
+			e.gauges[item.Name][location] = value
+
+			if _, ok := e.histograms[item.Name][location]; !ok {
+				e.histograms[item.Name][location] = &histogram{}
+			}
+
+			e.histograms[item.Name][location].observe(value)
+		}
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if err := e.Write(w); err != nil {
+		fmt.Fprintln(os.Stderr, "exporter.Write", err)
+	}
+}
+
+// Write prints the metrics using the Prometheus text-based format.
+func (e *Exporter) Write(w io.Writer) error {
+	e.Lock()
+	defer e.Unlock()
+
+	var b strings.Builder
+
+	for _, item := range series {
+		name := "webttfb_last_" + item.Name + "_seconds"
+		fmt.Fprintf(&b, "# HELP %s %s of the last successful test.\n", name, item.Help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, key := range sortedKeys(e.gauges[item.Name]) {
+			fmt.Fprintf(&b, "%s{%s} %g\n", name, key, e.gauges[item.Name][key])
+		}
+
+		name = "webttfb_" + item.Name + "_seconds"
+		fmt.Fprintf(&b, "# HELP %s %s of the successful tests.\n", name, item.Help)
+		fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+		for _, key := range sortedHistograms(e.histograms[item.Name]) {
+			h := e.histograms[item.Name][key]
+			for idx, bound := range buckets {
+				fmt.Fprintf(&b, "%s_bucket{%s,le=\"%g\"} %d\n", name, key, bound, h.Counts[idx])
+			}
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, key, h.Count)
+			fmt.Fprintf(&b, "%s_sum{%s} %g\n", name, key, h.Sum)
+			fmt.Fprintf(&b, "%s_count{%s} %d\n", name, key, h.Count)
+		}
+	}
+
+	writeCounter(&b, "webttfb_failures_total", "Number of failed tests per testing server.", "counter", e.failures)
+	writeCounter(&b, "webttfb_errors_total", "Number of error messages reported per testing server.", "counter", e.errors)
+	writeCounter(&b, "webttfb_runs_total", "Number of times the website was tested.", "counter", e.runs)
+	writeCounter(&b, "webttfb_last_run_timestamp_seconds", "Time when the last test finished.", "gauge", e.lastRun)
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// writeCounter prints one metric without histogram buckets.
+func writeCounter(b *strings.Builder, name string, help string, kind string, values map[string]float64) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(b, "%s{%s} %g\n", name, key, values[key])
+	}
+}
+
+// stableTitle returns the name of the testing server for the labels. The local
+// tests include the download speed in the name, which would create a new time
+// series after every test, so the speed is removed.
+func stableTitle(data Result) string {
+	if data.Prober == "local" {
+		return "Local"
+	}
+
+	return data.Output.ServerTitle
+}
+
+// labels builds the label set of a metric from pairs of names and values.
+func labels(pairs ...string) string {
+	var parts []string
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+"=\""+replacer.Replace(pairs[i+1])+"\"")
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// sortedKeys returns the label sets in alphabetical order.
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// sortedHistograms returns the label sets in alphabetical order.
+func sortedHistograms(values map[string]*histogram) []string {
+	keys := make([]string, 0, len(values))
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// exporterCommand tests the websites every interval and serves the metrics.
+func exporterCommand(args []string) int {
+	flags := flag.NewFlagSet("exporter", flag.ExitOnError)
+	listen := flags.String("listen", ":9713", "Address for the HTTP server")
+	every := flags.Duration("every", 5*time.Minute, "Time between tests of the same website")
+	domain := flags.String("d", "example.com", "Domain name or URL to be tested")
+	configFile := flags.String("config", "", "Configuration file, default $WEBTTFB_CONFIG or the first file found")
+	domains := flags.String("f", "", "File with one domain name or URL per line")
+	private := flags.Bool("p", true, "Hide results from public stats")
+	include := flags.String("include", "", "Test only the servers matching an ID, tag, region or title, comma-separated")
+	exclude := flags.String("exclude", "", "Skip the servers matching an ID, tag, region or title, comma-separated")
+	probe := flags.String("probe", "", "Prober used for every server (sucuri, local, agent)")
+	workers := flags.Int("workers", 0, "Maximum number of simultaneous tests, 0 is unlimited")
+	rate := flags.Float64("rate", 0, "Maximum number of tests started per second, 0 is unlimited")
+	timeout := flags.Duration("probe-timeout", time.Minute, "Maximum duration of each test")
+	retries := flags.Int("retries", 2, "Number of retries for tests with transient failures")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	names := []string{*domain}
+
+	if *domains != "" {
+		var err error
+
+		if names, err = ReadDomains(*domains); err != nil {
+			fmt.Fprintf(os.Stderr, "ReadDomains %s\n", err)
+			return 1
+		}
+	}
+
+	if *probe != "" {
+		if _, err := LookupProber(*probe); err != nil {
+			fmt.Fprintf(os.Stderr, "LookupProber %s\n", err)
+			return 1
+		}
+	}
+
+	limiter := NewLimiter(*workers, *rate)
+
+	exporter := NewExporter()
+
+	go func() {
+		for {
+			var testers []*TTFB
+
+			// Reload the configuration to pick up the changes.
+			cfg, err := FindConfig(*configFile)
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "LoadConfig %s\n", err)
+				cfg = &Config{}
+			}
+
+			if err := cfg.Filter(splitList(*include), splitList(*exclude)); err != nil {
+				fmt.Fprintf(os.Stderr, "Filter %s\n", err)
+			}
+
+			for _, name := range names {
+				tester, err := NewTTFB(name, *private, cfg)
+
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "NewTTFB %s\n", err)
+					continue
+				}
+
+				tester.Prober = *probe
+				tester.Timeout = *timeout
+				tester.Retries = *retries
+				tester.Backoff = time.Second
+				tester.Limiter = limiter
+				testers = append(testers, tester)
+			}
+
+			AnalyzeAll(context.Background(), testers, false)
+
+			for _, tester := range testers {
+				exporter.Collect(tester, time.Now())
+			}
+
+			time.Sleep(*every)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	fmt.Fprintf(os.Stderr, "Exporter listening on %s/metrics\n", *listen)
+
+	if err := server.ListenAndServe(); err != nil {
+		fmt.Fprintf(os.Stderr, "ListenAndServe %s\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// formats holds the output formats accepted by the "-format" flag.
+var formats = map[string]bool{
+	"table":    true,
+	"json":     true,
+	"csv":      true,
+	"tsv":      true,
+	"html":     true,
+	"markdown": true,
+}
+
+// columns holds the header of the CSV and TSV formats, new columns must be
+// appended at the end to keep the order stable for existing spreadsheets.
+var columns = []string{
+	"domain",
+	"server_id",
+	"server_title",
+	"prober",
+	"status",
+	"message",
+	"timed_out",
+	"attempts",
+	"timestamp",
+	"ip",
+	"namelookup_time",
+	"connect_time",
+	"appconnect_time",
+	"pretransfer_time",
+	"firstbyte_time",
+	"total_time",
+	"redirect_time",
+	"num_redirects",
+	"domain_id",
+	"domain_unique",
+	"server_abbr",
+	"server_flag_image",
+	"domain_and_ip",
+	"request_time",
+	"server_location",
+	"server_latitude",
+	"server_longitude",
+}
+
+// ValidateFormat returns an error if the output format is not supported.
+func ValidateFormat(format string) error {
+	if !formats[format] {
+		return fmt.Errorf("invalid output format %q, expected table, json, csv, tsv, html or markdown", format)
+	}
+
+	return nil
+}
+
+// WriteDelimited prints one row per test with all the fields of the result,
+// the rows are sorted with the same criteria as the table. The tests without a
+// timestamp, like the failures, use the time when the program finished.
+func WriteDelimited(w io.Writer, testers []*TTFB, sorting string, comma rune, when time.Time) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+
+	for _, tester := range testers {
+		for _, data := range tester.Report(sorting) {
+			if err := writer.Write(record(tester.Domain, data, when)); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// record returns the values of the result in the same order as the columns.
+func record(domain string, data Result, when time.Time) []string {
+	timestamp := when
+
+	if data.LastTestTime > 0 {
+		timestamp = time.Unix(int64(data.LastTestTime), 0)
+	}
+
+	return []string{
+		domain,
+		data.Output.ServerID,
+		data.Output.ServerTitle,
+		data.Prober,
+		strconv.Itoa(data.Status),
+		data.Message,
+		strconv.FormatBool(data.TimedOut),
+		strconv.Itoa(data.Attempts),
+		timestamp.UTC().Format(time.RFC3339),
+		data.Output.IP,
+		decimal(data.Output.NameLookupTime),
+		decimal(data.Output.ConnectTime),
+		decimal(data.Output.AppConnectTime),
+		decimal(data.Output.PreTransferTime),
+		decimal(data.Output.FirstByteTime),
+		decimal(data.Output.TotalTime),
+		decimal(data.Output.RedirectTime),
+		strconv.Itoa(data.Output.NumRedirects),
+		data.Output.DomainID,
+		data.Output.DomainUnique,
+		data.Output.ServerAbbr,
+		data.Output.ServerFlagImage,
+		data.Output.DomainAndIP,
+		strconv.FormatInt(data.Output.RequestTime, 10),
+		data.Output.ServerLocation,
+		decimal(data.Output.ServerLatitude),
+		decimal(data.Output.ServerLongitude),
+	}
+}
+
+// decimal formats the number without exponent and without losing precision.
+func decimal(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
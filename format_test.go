@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWriteDelimited checks the order of the columns, which must not change
+// because existing spreadsheets read them by position.
+func TestWriteDelimited(t *testing.T) {
+	var buf bytes.Buffer
+
+	tester := &TTFB{
+		Domain: "example.com",
+		Results: []Result{{
+			Message:      "OK",
+			Status:       1,
+			Prober:       "local",
+			Attempts:     2,
+			LastTestTime: 1700000000,
+			Output: Info{
+				IP:              "192.0.2.1",
+				NameLookupTime:  0.001,
+				ConnectTime:     0.002,
+				AppConnectTime:  0.003,
+				PreTransferTime: 0.004,
+				FirstByteTime:   0.005,
+				TotalTime:       0.006,
+				RedirectTime:    0.007,
+				NumRedirects:    8,
+				DomainID:        "d9",
+				DomainUnique:    "u10",
+				ServerID:        "8e84827",
+				ServerAbbr:      "us",
+				ServerTitle:     "USA, Dallas",
+				ServerFlagImage: "us.png",
+				DomainAndIP:     "example.com (192.0.2.1)",
+				RequestTime:     11,
+				ServerLocation:  "Dallas",
+				ServerLatitude:  32.7767,
+				ServerLongitude: -96.797,
+			},
+		}},
+	}
+
+	if err := WriteDelimited(&buf, []*TTFB{tester}, "status", '\t', time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"domain\tserver_id\tserver_title\tprober\tstatus\tmessage\ttimed_out\tattempts\ttimestamp\tip\t" +
+			"namelookup_time\tconnect_time\tappconnect_time\tpretransfer_time\tfirstbyte_time\ttotal_time\t" +
+			"redirect_time\tnum_redirects\tdomain_id\tdomain_unique\tserver_abbr\tserver_flag_image\t" +
+			"domain_and_ip\trequest_time\tserver_location\tserver_latitude\tserver_longitude",
+		"example.com\t8e84827\tUSA, Dallas\tlocal\t1\tOK\tfalse\t2\t2023-11-14T22:13:20Z\t192.0.2.1\t" +
+			"0.001\t0.002\t0.003\t0.004\t0.005\t0.006\t" +
+			"0.007\t8\td9\tu10\tus\tus.png\t" +
+			"example.com (192.0.2.1)\t11\tDallas\t32.7767\t-96.797",
+	}
+
+	if actual := buf.String(); actual != strings.Join(expected, "\n")+"\n" {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+}
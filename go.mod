@@ -0,0 +1,3 @@
+module github.com/cixtor/webttfb
+
+go 1.16
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sparks holds the characters used to draw the trend of each location.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Record holds one test result in the history file, each line of the file is
+// one JSON-encoded record, which makes it possible to append new results
+// without reading the entire file. The records of the same run share the run
+// identifier, the time in nanoseconds, so two runs in the same second are not
+// merged.
+type Record struct {
+	Domain   string `json:"domain"`
+	Time     int64  `json:"time"`
+	Run      int64  `json:"run"`
+	ServerID string `json:"server_id"`
+	Result   Result `json:"result"`
+}
+
+// Run holds the results of one execution of the program against a website.
+type Run struct {
+	ID      int64
+	Time    int64
+	Results []Result
+}
+
+// Trend holds the evolution of one timing group for one location, the last
+// value is compared with the average of the values of the previous runs.
+type Trend struct {
+	ServerID    string
+	ServerTitle string
+	Values      []float64
+	Last        float64
+	Baseline    float64
+	Change      float64
+	Regression  bool
+}
+
+// HistoryPath returns the location of the history file. The file lives in the
+// data directory defined by the XDG Base Directory specification.
+//
+// @ref: https://specifications.freedesktop.org/basedir-spec/latest/
+func HistoryPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+
+	return filepath.Join(dir, "webttfb", "history.jsonl")
+}
+
+// SaveHistory appends the results of the tests to the history file.
+func (t *TTFB) SaveHistory(filename string, when time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	enc := json.NewEncoder(writer)
+
+	for _, data := range t.Results {
+		record := Record{
+			Domain:   t.Domain,
+			Time:     when.Unix(),
+			Run:      when.UnixNano(),
+			ServerID: data.Output.ServerID,
+			Result:   data,
+		}
+
+		if err := enc.Encode(record); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// LoadHistory returns the runs stored in the history file for the domain name
+// sorted from the oldest to the newest. Lines that cannot be decoded are
+// reported with their line number.
+func LoadHistory(filename string, domain string) ([]Run, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := file.Close(); err != nil {
+			fmt.Println("file.Close", err)
+		}
+	}()
+
+	var lineno int
+	var runs []Run
+
+	index := make(map[int64]int)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var record Record
+
+		lineno++
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, lineno, err)
+		}
+
+		if record.Domain != domain {
+			continue
+		}
+
+		idx, ok := index[record.Run]
+
+		if !ok {
+			idx = len(runs)
+			index[record.Run] = idx
+			runs = append(runs, Run{ID: record.Run, Time: record.Time})
+		}
+
+		runs[idx].Results = append(runs[idx].Results, record.Result)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(runs, func(i int, j int) bool {
+		return runs[i].ID < runs[j].ID
+	})
+
+	return runs, nil
+}
+
+// Trends compares the last run with the previous runs, at most the specified
+// number of them, and returns the evolution of the timing group per location.
+// The value of a location in one run is the median of its successful samples.
+// A location regresses when the last value is higher than the baseline by more
+// than the threshold, which is a percentage.
+func Trends(runs []Run, group string, previous int, threshold float64) []Trend {
+	var order []string
+
+	if previous > 0 && len(runs) > previous+1 {
+		runs = runs[len(runs)-previous-1:]
+	}
+
+	trends := make(map[string]*Trend)
+
+	for idx, run := range runs {
+		tester := &TTFB{Results: run.Results}
+
+		for _, loc := range tester.Locations(group) {
+			trend, ok := trends[loc.ServerID]
+
+			if !ok {
+				trend = &Trend{ServerID: loc.ServerID, ServerTitle: loc.ServerTitle}
+				trends[loc.ServerID] = trend
+				order = append(order, loc.ServerID)
+			}
+
+			if loc.Stats.Count == 0 {
+				continue
+			}
+
+			if idx == len(runs)-1 {
+				trend.Last = loc.Stats.Median
+			}
+
+			trend.Values = append(trend.Values, loc.Stats.Median)
+		}
+	}
+
+	list := make([]Trend, 0, len(order))
+
+	for _, unique := range order {
+		trend := trends[unique]
+
+		if trend.Last > 0 && len(trend.Values) > 1 {
+			var sum float64
+
+			past := trend.Values[:len(trend.Values)-1]
+
+			for _, value := range past {
+				sum += value
+			}
+
+			trend.Baseline = sum / float64(len(past))
+			trend.Change = (trend.Last - trend.Baseline) / trend.Baseline * 100
+			trend.Regression = trend.Change > threshold
+		}
+
+		list = append(list, *trend)
+	}
+
+	return list
+}
+
+// Sparkline draws the values with block characters of different heights.
+func Sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	low, high := values[0], values[0]
+
+	for _, value := range values {
+		if value < low {
+			low = value
+		}
+		if value > high {
+			high = value
+		}
+	}
+
+	var line []rune
+
+	for _, value := range values {
+		idx := 0
+
+		if high > low {
+			idx = int((value - low) / (high - low) * float64(len(sparks)-1))
+		}
+
+		line = append(line, sparks[idx])
+	}
+
+	return string(line)
+}
+
+// historyCommand prints the evolution of the results of the website per
+// location and flags the locations that regressed compared to the previous
+// runs.
+func historyCommand(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	domain := flags.String("d", "example.com", "Domain name to be reviewed")
+	metric := flags.String("m", timeToFirstByte, "Timing group to review (conn, ttfb, ttl, etc)")
+	previous := flags.Int("runs", 5, "Number of previous runs to compare with")
+	threshold := flags.Float64("threshold", 20, "Percentage over the previous runs considered a regression")
+	filename := flags.String("file", HistoryPath(), "Location of the history file")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, ok := abbrs[*metric]; !ok {
+		fmt.Fprintf(os.Stderr, "history: invalid timing group %q\n", *metric)
+		return 2
+	}
+
+	runs, err := LoadHistory(*filename, *domain)
+
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(runs) == 0) {
+		fmt.Fprintf(os.Stderr, "history: there are no results for %s\n", *domain)
+		return 1
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LoadHistory %s\n", err)
+		return 1
+	}
+
+	var icon string
+	var regressions int
+
+	trends := Trends(runs, *metric, *previous, *threshold)
+	last := time.Unix(runs[len(runs)-1].Time, 0)
+
+	fmt.Printf("    %s history of %s, last run %s\n", abbrs[*metric], *domain, last.Format(time.RFC3339))
+	fmt.Println("    " + rule("┌", "┬", "┐", 5))
+	fmt.Println("    │ Server  │ Runs  │ Last  │ Base  │ Diff  │ Trend │ Location           │")
+	fmt.Println("┌───" + rule("┼", "┼", "┤", 5))
+
+	for _, trend := range trends {
+		switch {
+		case trend.Regression:
+			regressions++
+			icon = "\033[0;31m\u25B2\033[0m"
+		case trend.Baseline == 0:
+			icon = "\033[0;2m?\033[0m"
+		default:
+			icon = "\033[0;32m\u2714\033[0m"
+		}
+
+		spark := []rune(Sparkline(trend.Values))
+
+		if len(spark) > 5 {
+			spark = spark[len(spark)-5:]
+		}
+
+		fmt.Printf(
+			"│ %s │ \033[0;2m%s\033[0m │ %s │ %s │ %.3f │ %s │ %s │ %s │\n",
+			icon,
+			trend.ServerID,
+			pad(fmt.Sprint(len(trend.Values)), 5),
+			Colorize(*metric, trend.Last),
+			trend.Baseline,
+			pad(fmt.Sprintf("%+.0f%%", trend.Change), 5),
+			string(spark)+strings.Repeat("\x20", 5-len(spark)),
+			pad(trend.ServerTitle, 18),
+		)
+	}
+
+	fmt.Println("└───" + rule("┴", "┴", "┘", 5))
+
+	if regressions > 0 {
+		fmt.Printf("\033[0;31m\u2022\033[0m %d location(s) regressed more than %.0f%%\n", regressions, *threshold)
+	}
+
+	return 0
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoadHistorySameSecond checks that two runs in the same second are not
+// merged and that the runs are sorted from the oldest to the newest.
+func TestLoadHistorySameSecond(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history.jsonl")
+	tester := &TTFB{Domain: "example.com", Results: []Result{{Status: 1}, {Status: 1}}}
+	when := time.Unix(1700000000, 0)
+
+	for _, offset := range []time.Duration{2, 1} {
+		if err := tester.SaveHistory(filename, when.Add(offset*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := LoadHistory(filename, "example.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+
+	if len(runs[0].Results) != 2 || runs[0].ID >= runs[1].ID || runs[0].Time != runs[1].Time {
+		t.Fatalf("expected two runs in the same second sorted by time, got %+v", runs)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// mapWidth and mapHeight define the size of the world map, two pixels per
+// degree using the equirectangular projection.
+const mapWidth float64 = 720
+const mapHeight float64 = 360
+
+// continents holds the simplified outline of the land masses as pairs of
+// longitude and latitude, precise enough to locate the testing servers.
+var continents = [][]float64{
+	// North America
+	{-168, 65, -160, 71, -140, 70, -125, 70, -95, 72, -80, 73, -62, 60, -55, 52, -66, 45, -70, 41, -76, 35, -81, 31, -80, 25, -83, 29, -90, 29, -97, 26, -97, 21, -90, 21, -87, 16, -83, 10, -78, 8, -86, 12, -92, 15, -105, 20, -110, 24, -117, 32, -124, 40, -124, 48, -135, 58, -150, 60, -165, 60},
+	// South America
+	{-78, 8, -72, 12, -62, 10, -50, 2, -35, -5, -38, -13, -41, -22, -48, -26, -53, -34, -58, -38, -65, -42, -68, -52, -72, -50, -74, -40, -71, -30, -70, -18, -76, -14, -81, -5, -80, 0},
+	// Greenland
+	{-73, 78, -60, 82, -30, 83, -20, 75, -22, 70, -40, 65, -50, 62, -55, 68, -66, 76},
+	// Europe and Asia
+	{-10, 36, -9, 43, -2, 44, -4, 48, 2, 51, 8, 54, 8, 57, 5, 62, 15, 69, 28, 71, 40, 68, 60, 70, 80, 73, 100, 77, 130, 72, 160, 70, 180, 68, 180, 65, 165, 60, 160, 53, 140, 55, 135, 43, 128, 35, 122, 40, 120, 31, 110, 20, 106, 10, 100, 14, 99, 7, 104, 1, 98, 8, 92, 21, 80, 15, 77, 8, 72, 20, 66, 25, 57, 25, 56, 27, 48, 30, 55, 22, 58, 20, 52, 16, 43, 12, 35, 28, 32, 31, 35, 36, 27, 37, 26, 40, 24, 38, 20, 40, 13, 45, 18, 40, 15, 38, 10, 44, 3, 43, -5, 36},
+	// Great Britain
+	{-5, 50, 1, 51, 2, 53, -2, 57, -5, 58, -6, 56, -3, 54},
+	// Japan
+	{130, 31, 135, 34, 140, 35, 142, 40, 141, 45, 140, 41, 136, 37, 131, 34},
+	// Africa
+	{-17, 21, -17, 15, -12, 7, -5, 5, 5, 6, 9, 4, 10, -2, 13, -12, 12, -18, 18, -34, 26, -34, 33, -27, 40, -16, 40, -10, 42, -1, 51, 12, 43, 12, 38, 18, 32, 31, 20, 32, 10, 37, -6, 36, -10, 30},
+	// Australia
+	{114, -22, 114, -34, 123, -34, 135, -35, 140, -38, 150, -38, 153, -28, 145, -15, 142, -11, 136, -12, 130, -12, 123, -17},
+	// New Zealand
+	{172, -34, 178, -38, 174, -42, 167, -46, 172, -41},
+}
+
+// gradeColors holds the background of each grade, the same colors used by the
+// terminal to render the performance grade.
+var gradeColors = map[string]string{
+	"A+": "#00afd7",
+	"A":  "#00af00",
+	"B":  "#ffff00",
+	"C":  "#ff0000",
+	"D":  "#ff0000",
+	"E":  "#af0000",
+	"~":  "#c0c0c0",
+	"F":  "#c0c0c0",
+}
+
+// htmlBar holds one of the timing values of a location.
+type htmlBar struct {
+	Label string
+	Value string
+	Width string
+	Level string
+}
+
+// htmlRow holds the results of one test.
+type htmlRow struct {
+	ServerID string
+	Title    string
+	Failed   bool
+	Message  string
+	Bars     []htmlBar
+}
+
+// htmlMarker holds the position of one testing server on the map.
+type htmlMarker struct {
+	X     string
+	Y     string
+	Level string
+	Label string
+}
+
+// htmlWebsite holds the results of one website.
+type htmlWebsite struct {
+	Domain     string
+	Grade      string
+	GradeColor string
+	Average    []htmlBar
+	Rows       []htmlRow
+	Markers    []htmlMarker
+	Errors     []string
+}
+
+// htmlReport holds the content of the HTML report.
+type htmlReport struct {
+	Generated  string
+	Width      float64
+	Height     float64
+	Graticule  []float64
+	Continents []string
+	Websites   []htmlWebsite
+}
+
+// htmlGroups lists the timing groups rendered as bars.
+var htmlGroups = []string{connectionTime, timeToFirstByte, totalTime}
+
+// WriteHTML prints a self-contained HTML document with the results of the
+// websites, which can be attached to a ticket or sent by email. The document
+// does not load external resources, the styles and the map are inline.
+func WriteHTML(w io.Writer, testers []*TTFB, sorting string, when time.Time) error {
+	report := htmlReport{
+		Generated: when.UTC().Format(time.RFC1123),
+		Width:     mapWidth,
+		Height:    mapHeight,
+	}
+
+	for lat := -60.0; lat <= 60; lat += 30 {
+		report.Graticule = append(report.Graticule, project(0, lat)[1])
+	}
+
+	for _, outline := range continents {
+		var points []string
+
+		for i := 0; i+1 < len(outline); i += 2 {
+			point := project(outline[i], outline[i+1])
+			points = append(points, fmt.Sprintf("%.1f,%.1f", point[0], point[1]))
+		}
+
+		report.Continents = append(report.Continents, strings.Join(points, "\x20"))
+	}
+
+	for _, tester := range testers {
+		report.Websites = append(report.Websites, htmlSite(tester, sorting))
+	}
+
+	return htmlTemplate.Execute(w, report)
+}
+
+// htmlSite converts the results of the website into the data of the report.
+func htmlSite(t *TTFB, sorting string) htmlWebsite {
+	var longest float64
+
+	level := Score(t)
+	site := htmlWebsite{
+		Domain:     t.Domain,
+		Grade:      level.Grade,
+		GradeColor: gradeColors[level.Grade],
+	}
+
+	// The bars are relative to the slowest test.
+	for _, data := range t.Results {
+		if data.Output.TotalTime > longest {
+			longest = data.Output.TotalTime
+		}
+	}
+
+	for _, group := range htmlGroups {
+		site.Average = append(site.Average, htmlMeasure(group, t.Average(group), longest))
+	}
+
+	for _, data := range t.Report(sorting) {
+		row := htmlRow{
+			ServerID: data.Output.ServerID,
+			Title:    data.Output.ServerTitle,
+			Failed:   data.Status != 1,
+			Message:  data.Message,
+		}
+
+		var ttl float64
+
+		for _, group := range htmlGroups {
+			value, _ := data.Output.Metric(group)
+			row.Bars = append(row.Bars, htmlMeasure(group, value, longest))
+
+			if group == totalTime {
+				ttl = value
+			}
+		}
+
+		site.Rows = append(site.Rows, row)
+
+		if marker, ok := htmlLocate(t, data, ttl); ok {
+			site.Markers = append(site.Markers, marker)
+		}
+	}
+
+	for _, message := range t.ErrorMessages() {
+		site.Errors = append(site.Errors, message.Error())
+	}
+
+	return site
+}
+
+// htmlMeasure builds the bar of one timing value.
+func htmlMeasure(group string, value float64, longest float64) htmlBar {
+	bar := htmlBar{
+		Label: abbrs[group],
+		Value: fmt.Sprintf("%.3f", value),
+		Width: "0%",
+	}
+
+	if longest > 0 {
+		bar.Width = fmt.Sprintf("%.1f%%", value/longest*100)
+	}
+
+	// Do not colorize failed tests.
+	if c := colorizer(group); c != nil && value > 0 {
+		bar.Level = Level(c, value)
+	}
+
+	return bar
+}
+
+// htmlLocate returns the marker of the testing server. The coordinates come
+// from the API service, or from the configuration file for the other probers.
+func htmlLocate(t *TTFB, data Result, ttl float64) (htmlMarker, bool) {
+	lat, long := data.Output.ServerLatitude, data.Output.ServerLongitude
+
+	if lat == 0 && long == 0 {
+		server := t.Servers[data.Output.ServerID]
+		lat, long = server.Latitude, server.Longitude
+	}
+
+	if lat == 0 && long == 0 {
+		return htmlMarker{}, false
+	}
+
+	point := project(long, lat)
+	marker := htmlMarker{
+		X:     fmt.Sprintf("%.1f", point[0]),
+		Y:     fmt.Sprintf("%.1f", point[1]),
+		Level: "failed",
+		Label: fmt.Sprintf("%s %s", data.Output.ServerID, data.Output.ServerTitle),
+	}
+
+	if data.Status == 1 {
+		marker.Level = Level(ColorTTL{}, ttl)
+		marker.Label += fmt.Sprintf(" (TTL %.3f)", ttl)
+	}
+
+	return marker, true
+}
+
+// project converts the coordinates to a point of the map.
+func project(long float64, lat float64) [2]float64 {
+	return [2]float64{
+		(long + 180) / 360 * mapWidth,
+		(90 - lat) / 180 * mapHeight,
+	}
+}
+
+// htmlTemplate renders the report, html/template escapes the values.
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Website TTFB{{range .Websites}} - {{.Domain}}{{end}}</title>
+<style>
+body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #222; margin: 2em auto; max-width: 960px; padding: 0 1em; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.2em; border-bottom: 1px solid #ddd; padding-bottom: .3em; margin-top: 2em; }
+.grade { display: inline-block; padding: .1em .6em; margin-left: .5em; border-radius: 3px; font-weight: bold; color: #fff; text-shadow: 0 0 2px #000; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3em .5em; border-bottom: 1px solid #eee; vertical-align: top; }
+th { font-weight: 600; }
+.id { color: #888; font-family: monospace; }
+.bar { display: flex; align-items: center; gap: .5em; margin: 1px 0; }
+.bar .label { width: 3em; color: #888; font-size: .85em; }
+.bar .track { flex: 1; background: #f3f3f3; height: 10px; }
+.bar .fill { height: 10px; background: #999; }
+.bar .value { width: 4em; text-align: right; font-family: monospace; }
+.success { background: #00af00 !important; fill: #00af00; }
+.warning { background: #ffd700 !important; fill: #ffd700; }
+.danger { background: #ff0000 !important; fill: #ff0000; }
+.failed { fill: #fff; stroke: #ff0000; stroke-width: 2; }
+circle { fill: #999; stroke: #fff; }
+.message { color: #c00; }
+.errors li { color: #06c; }
+svg { width: 100%; height: auto; background: #eaf4fb; }
+svg polygon { fill: #d8d8d8; stroke: #c0c0c0; }
+svg line { stroke: #d0e4f0; }
+footer { color: #888; font-size: .85em; margin-top: 2em; }
+</style>
+</head>
+<body>
+<h1>Website TTFB</h1>
+{{$map := .}}
+{{range .Websites}}
+<h2>{{.Domain}} <span class="grade" style="background: {{.GradeColor}}">Performance: {{.Grade}}</span></h2>
+<svg viewBox="0 0 {{$map.Width}} {{$map.Height}}" xmlns="http://www.w3.org/2000/svg" role="img" aria-label="Testing servers">
+{{range $map.Graticule}}<line x1="0" y1="{{.}}" x2="{{$map.Width}}" y2="{{.}}"/>
+{{end}}{{range $map.Continents}}<polygon points="{{.}}"/>
+{{end}}{{range .Markers}}<circle cx="{{.X}}" cy="{{.Y}}" r="5" class="{{.Level}}"><title>{{.Label}}</title></circle>
+{{end}}</svg>
+<table>
+<tr><th>Server</th><th>Location</th><th>Timing (seconds)</th></tr>
+<tr><td></td><td><strong>Average</strong></td><td>{{template "bars" .Average}}</td></tr>
+{{range .Rows}}<tr>
+<td class="id">{{.ServerID}}</td>
+<td>{{.Title}}{{if and .Failed .Message}}<div class="message">{{.Message}}</div>{{end}}</td>
+<td>{{template "bars" .Bars}}</td>
+</tr>
+{{end}}</table>
+{{if .Errors}}<h3>Errors</h3>
+<ul class="errors">
+{{range .Errors}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}{{end}}
+<footer>Generated on {{.Generated}} &middot; https://github.com/cixtor/webttfb</footer>
+</body>
+</html>
+{{define "bars"}}{{range .}}<div class="bar"><span class="label">{{.Label}}</span><span class="track"><div class="fill {{.Level}}" style="width: {{.Width}}"></div></span><span class="value">{{.Value}}</span></div>{{end}}{{end}}
+`))
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter bounds the number of simultaneous tests and the number of tests that
+// start every second. The same limiter can be shared by multiple instances of
+// TTFB to test multiple websites with the same budget. A nil limiter does not
+// limit anything.
+type Limiter struct {
+	sync.Mutex
+	slots    chan struct{}
+	interval time.Duration
+	next     time.Time
+}
+
+// NewLimiter returns a limiter for the number of workers and the number of
+// requests per second, zero means unlimited in both cases.
+func NewLimiter(workers int, rate float64) *Limiter {
+	if workers <= 0 && rate <= 0 {
+		return nil
+	}
+
+	l := &Limiter{}
+
+	if workers > 0 {
+		l.slots = make(chan struct{}, workers)
+	}
+
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+
+	return l
+}
+
+// Acquire blocks until there is a free worker and the rate allows another test
+// to start, or until the context is done, in which case it returns the error
+// of the context and the caller must not call Release.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if l.interval > 0 && !sleep(ctx, l.reserve()) {
+		l.Release()
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// reserve returns the time to wait until the next test can start and moves the
+// schedule forward by one interval.
+func (l *Limiter) reserve() time.Duration {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+
+	if l.next.Before(now) {
+		l.next = now
+	}
+
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+
+	return wait
+}
+
+// Release frees the worker acquired by the test.
+func (l *Limiter) Release() {
+	if l == nil || l.slots == nil {
+		return
+	}
+
+	<-l.slots
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 )
 
 const config string = ".webttfb.cfg"
@@ -13,12 +18,73 @@ const service string = "https://performance.sucuri.net/index.php?ajaxcall"
 const timeToFirstByte string = "ttfb"
 const connectionTime string = "conn"
 const totalTime string = "ttl"
+const nameLookupTime string = "dns"
+const appConnectTime string = "tls"
+const preTransferTime string = "pre"
+const redirectTime string = "redir"
 
-var domain = flag.String("d", "example.com", "Domain name to be tested")
+// abbrs maps the timing groups to the column names printed in the table.
+var abbrs = map[string]string{
+	nameLookupTime:  "DNS",
+	connectionTime:  "Conn",
+	appConnectTime:  "TLS",
+	preTransferTime: "Pre",
+	timeToFirstByte: "TTFB",
+	totalTime:       "TTL",
+	redirectTime:    "Redir",
+}
+
+var domain = flag.String("d", "example.com", "Domain name or URL to be tested")
+var configFile = flag.String("config", "", "Configuration file, default $WEBTTFB_CONFIG or the first file found")
+var include = flag.String("include", "", "Test only the servers matching an ID, tag, region or title, comma-separated")
+var exclude = flag.String("exclude", "", "Skip the servers matching an ID, tag, region or title, comma-separated")
+var profile = flag.String("profile", "", "Profile from the configuration file, default matches -d")
+var versus = flag.String("vs", "", "Second domain name tested from the same locations (A/B mode)")
+var method = flag.String("method", http.MethodGet, "HTTP method of the local tests")
+var body = flag.String("body", "", "File with the request body of the local tests (- for stdin)")
+var basicAuth = flag.String("user", "", "Basic authentication of the local tests, user:password")
+var bearer = flag.String("bearer", "", "Bearer token of the local tests")
+var eachIP = flag.Bool("each-ip", false, "Test every IPv4 and IPv6 address of the website, local tests only")
+var headers listFlag
+var cookies listFlag
+var resolve listFlag
+var domains = flag.String("f", "", "File with one domain name or URL per line (- for stdin)")
+var workers = flag.Int("workers", 0, "Maximum number of simultaneous tests, 0 is unlimited (1 with -l, 8 with -f)")
+var rate = flag.Float64("rate", 0, "Maximum number of tests started per second, 0 is unlimited")
+var deadline = flag.Duration("timeout", 0, "Maximum duration of all the tests, 0 is unlimited")
+var probeTimeout = flag.Duration("probe-timeout", time.Minute, "Maximum duration of each test")
+var retries = flag.Int("retries", 0, "Number of retries for tests with transient failures")
+var backoff = flag.Duration("backoff", time.Second, "Initial time between retries, doubled after each one")
 var sorting = flag.String("s", "status", "Criteria to sort the results")
 var private = flag.Bool("p", false, "Hide results from public stats")
-var export = flag.Bool("json", false, "Print the test results as JSON")
+var export = flag.Bool("json", false, "Print the test results as JSON, same as -format json")
+var format = flag.String("format", "table", "Output format (table, json, csv, tsv, html, markdown)")
+var baselineFile = flag.String("baseline", "", "Results printed with -json to compare with, -format markdown")
 var local = flag.Bool("l", false, "Run the tests with local resources")
+var samples = flag.Int("n", 1, "Number of samples per location")
+var interval = flag.Duration("interval", 0, "Time between samples of the same location")
+var maxAverage = flag.Float64("max-ttfb", 0, "Budget: maximum average TTFB in seconds")
+var maxTTL = flag.Float64("max-ttl", 0, "Budget: maximum TTL per location in seconds")
+var minGrade = flag.String("min-grade", "", "Budget: minimum performance grade (A+, A, B, C, D, E)")
+var maxFailures = flag.Int("max-failures", -1, "Budget: maximum number of failed tests")
+var budgetReport = flag.String("budget-report", "", "Write the budget summary as JSON to this file (- for stderr)")
+var history = flag.String("history", HistoryPath(), "File where every run appends its results, empty to disable")
+var probe = flag.String("probe", "", "Prober used for every server (sucuri, local, agent)")
+
+// commands holds the list of sub-commands, "webttfb <command> [flags]".
+var commands = map[string]func(args []string) int{
+	"agent":    agentCommand,
+	"compare":  compareCommand,
+	"exporter": exporterCommand,
+	"history":  historyCommand,
+	"servers":  serversCommand,
+}
+
+func init() {
+	flag.Var(&headers, "H", "Request header of the local tests, \"Name: value\", repeatable")
+	flag.Var(&resolve, "resolve", "Connect to the addresses instead of resolving host:port, host:port:addr[,addr] like curl --resolve, repeatable")
+	flag.Var(&cookies, "cookie", "Cookies of the local tests, \"name=value; name2=value2\", repeatable")
+}
 
 func main() {
 	flag.Usage = func() {
@@ -35,82 +101,486 @@ func main() {
 		fmt.Println("connection time, the time taken to send the HTTP request, and the time taken to")
 		fmt.Println("get the first byte of the page.")
 		fmt.Println()
-		fmt.Println("Sorting: status, conn, ttfb, ttl")
+		fmt.Println("Sorting: status, dns, conn, tls, pre, ttfb, ttl, redir")
+		fmt.Println("Statistics: min, median, mean, p90, p99, max, stddev (-n > 1)")
+		fmt.Println("  Example: -n 10 -s ttfb:p90")
 		fmt.Println()
 		fmt.Println("Usage:")
 		flag.PrintDefaults()
 		fmt.Println()
+		fmt.Println("History, enabled by default:")
+		fmt.Println("  Every run appends its results to " + HistoryPath())
+		fmt.Println("  including -json, -format and budget runs, -history \"\" disables it")
+		fmt.Println()
+		fmt.Println("Configuration, the first file found:")
+		fmt.Println("  -config flag, $WEBTTFB_CONFIG")
+		for _, candidate := range ConfigPaths() {
+			fmt.Println("  " + candidate)
+		}
+		fmt.Println("  built-in server list")
+		fmt.Println("  " + config + " cannot set -history or -budget-report")
+		fmt.Println()
+		fmt.Println("Exit codes:")
+		fmt.Println("  0     All the budgets were respected")
+		fmt.Println("  1     The tests could not be executed")
+		fmt.Println("  130   The tests were interrupted with Ctrl-C, takes precedence over the budgets")
+		fmt.Println("  16+   Budget violations, sum of: 1 max-ttfb, 2 max-ttl, 4 min-grade, 8 max-failures")
+		fmt.Println()
+		fmt.Println("Commands:")
+		fmt.Println("  agent     Run as a self-hosted testing server")
+		fmt.Println("  compare   Compare two result sets and detect regressions")
+		fmt.Println("  exporter  Test periodically and serve Prometheus metrics")
+		fmt.Println("  history   Show the trend of the results per location")
+		fmt.Println("  servers   List the testing servers or update them from the service")
+		fmt.Println()
 		fmt.Println("Abbrs:")
 		fmt.Println("  Time is measured in seconds")
 		fmt.Println("  Performance is based on TTL")
-		fmt.Println("  Conn — Connection Time")
-		fmt.Println("  TTFB — Time To First Byte")
-		fmt.Println("  TTL  — Total Time")
+		fmt.Println("  DNS   — Name Lookup Time (local)")
+		fmt.Println("  Conn  — Connection Time")
+		fmt.Println("  TLS   — TLS Handshake Time (local)")
+		fmt.Println("  Pre   — Pre-Transfer Time (local)")
+		fmt.Println("  TTFB  — Time To First Byte")
+		fmt.Println("  TTL   — Total Time")
+		fmt.Println("  Redir — Redirection Time (local)")
+		fmt.Println("  Try   — Number of attempts (-retries)")
 		os.Exit(2)
 	}
 
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+			return
+		}
+	}
+
 	flag.Parse()
 
 	var err error
-	var icon string
-	var tester *TTFB
+	var cfg *Config
+	var names []string
+	var testers []*TTFB
+
+	if cfg, err = FindConfig(*configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfig %s", err)
+		os.Exit(1)
+		return
+	}
+
+	if err = cfg.Apply(flag.CommandLine, cfg.Profile(*profile, *domain)); err != nil {
+		fmt.Fprintf(os.Stderr, "LoadConfig %s", err)
+		os.Exit(1)
+		return
+	}
 
-	if tester, err = NewTTFB(*domain, *private); err != nil {
-		fmt.Fprintf(os.Stderr, "NewTTFB %s", err)
+	if *profile != "" && cfg.Profile(*profile, "") == nil {
+		fmt.Fprintf(os.Stderr, "LoadConfig profile %q does not exist", *profile)
 		os.Exit(1)
 		return
 	}
 
-	tester.Analyze(*local, !*export)
+	if err = cfg.Filter(splitList(*include), splitList(*exclude)); err != nil {
+		fmt.Fprintf(os.Stderr, "Filter %s", err)
+		os.Exit(1)
+		return
+	}
+
+	if *domains != "" {
+		if names, err = ReadDomains(*domains); err != nil {
+			fmt.Fprintf(os.Stderr, "ReadDomains %s", err)
+			os.Exit(1)
+			return
+		}
+	} else {
+		names = []string{*domain}
+	}
+
+	if *versus != "" {
+		if *domains != "" {
+			fmt.Fprint(os.Stderr, "Flags -vs and -f cannot be used together")
+			os.Exit(1)
+			return
+		}
+		// The rows of each IP address are not the same in both websites.
+		if *eachIP || len(resolve) > 0 {
+			fmt.Fprint(os.Stderr, "Flags -vs, -resolve and -each-ip cannot be used together")
+			os.Exit(1)
+			return
+		}
+		names = append(names, *versus)
+	}
+
+	if *local {
+		*probe = "local"
+	}
+
+	if *probe != "" {
+		if _, err = LookupProber(*probe); err != nil {
+			fmt.Fprintf(os.Stderr, "LookupProber %s", err)
+			os.Exit(1)
+			return
+		}
+	}
 
 	if *export {
-		if err = json.NewEncoder(os.Stdout).Encode(tester.Results); err != nil {
+		*format = "json"
+	}
+
+	if err = ValidateFormat(*format); err != nil {
+		fmt.Fprintf(os.Stderr, "Format %s", err)
+		os.Exit(1)
+		return
+	}
+
+	request, err := requestFromFlags()
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Request %s", err)
+		os.Exit(1)
+		return
+	}
+
+	if request.Custom() && *probe != "local" {
+		fmt.Fprint(os.Stderr, "Request options are only supported by the local tests, use -l")
+		os.Exit(1)
+		return
+	}
+
+	pins := make([]Pin, len(resolve))
+
+	for idx, entry := range resolve {
+		if pins[idx], err = ParsePin(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "Resolve %s", err)
+			os.Exit(1)
+			return
+		}
+	}
+
+	if (*eachIP || len(pins) > 0) && *probe != "local" {
+		fmt.Fprint(os.Stderr, "Flags -resolve and -each-ip are only supported by the local tests, use -l")
+		os.Exit(1)
+		return
+	}
+
+	budget := Budget{
+		MaxAverage:  *maxAverage,
+		MaxTTL:      *maxTTL,
+		MinGrade:    *minGrade,
+		MaxFailures: *maxFailures,
+	}
+
+	if err = budget.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Budget %s", err)
+		os.Exit(1)
+		return
+	}
+
+	if !isFlagSet("workers") {
+		// Local tests share the same internet connection, running them one
+		// after another prevents them from competing for the bandwidth.
+		if *probe == "local" {
+			*workers = 1
+		} else if len(names) > 1 {
+			*workers = batchWorkers
+		}
+	}
+
+	limiter := NewLimiter(*workers, *rate)
+	used := make([]bool, len(pins))
+
+	for _, name := range names {
+		tester, err := NewTTFB(name, *private, cfg)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "NewTTFB %s", err)
+			os.Exit(1)
+			return
+		}
+
+		var pinned []string
+		var port string
+
+		for idx, pin := range pins {
+			if pin.Matches(tester.URL) {
+				pinned = append(pinned, pin.Addrs...)
+				port = pin.Port
+				used[idx] = true
+			}
+		}
+
+		if len(pinned) > 0 {
+			tester.TestAddresses(pinned, port)
+		} else if *eachIP {
+			ctx, cancel := context.WithTimeout(context.Background(), *probeTimeout)
+			addrs, err := Addresses(ctx, tester.URL.Hostname())
+			cancel()
+
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Addresses %s", err)
+				os.Exit(1)
+				return
+			}
+
+			tester.TestAddresses(addrs, "")
+		}
+
+		tester.Prober = *probe
+		tester.Request = request
+		tester.Samples = *samples
+		tester.Interval = *interval
+		tester.Timeout = *probeTimeout
+		tester.Retries = *retries
+		tester.Backoff = *backoff
+		tester.Limiter = limiter
+		testers = append(testers, tester)
+	}
+
+	// A typo would test the public website instead of the staging origin.
+	for idx, ok := range used {
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Resolve %q does not match the host and port of any website", resolve[idx])
+			os.Exit(1)
+			return
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		// Restore the default behavior, a second Ctrl-C exits immediately.
+		<-ctx.Done()
+		stop()
+	}()
+
+	if *deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *deadline)
+		defer cancel()
+	}
+
+	batch := len(testers) > 1
+
+	if *versus != "" {
+		AnalyzePair(ctx, testers[0], testers[1], *format == "table")
+	} else if batch {
+		AnalyzeAll(ctx, testers, *format == "table")
+	} else {
+		testers[0].Analyze(ctx, *format == "table")
+	}
+
+	interrupted := ctx.Err() == context.Canceled
+
+	if interrupted {
+		fmt.Fprintln(os.Stderr, "Interrupted, printing the results gathered so far")
+	}
+
+	report := BudgetReport{Passed: true, Violations: []Violation{}}
+
+	reports := make([]BudgetReport, len(testers))
+	finished := time.Now()
+
+	for idx, tester := range testers {
+		if *history != "" {
+			if err = tester.SaveHistory(*history, finished); err != nil {
+				fmt.Fprintf(os.Stderr, "SaveHistory %s\n", err)
+			}
+		}
+
+		reports[idx] = budget.Evaluate(tester)
+		report.Merge(reports[idx])
+	}
+
+	exitCode := report.ExitCode
+
+	if interrupted {
+		// Same exit code as a shell killed by SIGINT, the budget bits are
+		// not added because 130 already has some of them set.
+		exitCode = 130
+	}
+
+	if err = writeBudgetReport(report, *budgetReport); err != nil {
+		fmt.Fprintf(os.Stderr, "Budget %s", err)
+		os.Exit(1)
+		return
+	}
+
+	switch *format {
+	case "csv", "tsv":
+		comma := ','
+		if *format == "tsv" {
+			comma = '\t'
+		}
+		if err = WriteDelimited(os.Stdout, testers, *sorting, comma, finished); err != nil {
+			fmt.Fprintf(os.Stderr, "WriteDelimited %s", err)
+			os.Exit(1)
+			return
+		}
+		os.Exit(exitCode)
+		return
+	case "markdown":
+		var baseline map[string][]Result
+		if *baselineFile != "" {
+			if baseline, err = LoadResults(*baselineFile); err != nil {
+				fmt.Fprintf(os.Stderr, "LoadResults %s", err)
+				os.Exit(1)
+				return
+			}
+		}
+		if err = WriteMarkdown(os.Stdout, testers, *sorting, baseline); err != nil {
+			fmt.Fprintf(os.Stderr, "WriteMarkdown %s", err)
+			os.Exit(1)
+			return
+		}
+		os.Exit(exitCode)
+		return
+	case "html":
+		if err = WriteHTML(os.Stdout, testers, *sorting, finished); err != nil {
+			fmt.Fprintf(os.Stderr, "WriteHTML %s", err)
+			os.Exit(1)
+			return
+		}
+		os.Exit(exitCode)
+		return
+	case "json":
+		if batch {
+			err = json.NewEncoder(os.Stdout).Encode(ResultsByDomain(testers))
+		} else {
+			err = json.NewEncoder(os.Stdout).Encode(testers[0].Results)
+		}
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "json.Encode %s", err)
 			os.Exit(1)
 			return
 		}
+		os.Exit(exitCode)
+		return
+	}
+
+	if *versus != "" {
+		PrintPair(testers[0], testers[1], *sorting)
+
+		for idx, tester := range testers {
+			label := []string{"A", "B"}[idx]
+
+			for _, message := range tester.ErrorMessages() {
+				fmt.Println("\033[0;94m\u2022\033[0m " + label + " " + message.Error())
+			}
+
+			for _, violation := range reports[idx].Violations {
+				fmt.Println("\033[0;31m\u2022\033[0m " + label + " " + violation.String())
+			}
+		}
+
+		os.Exit(exitCode)
 		return
 	}
 
-	fmt.Println("    ┌─────────┬───────┬───────┬───────┬────────────────────┐")
-	fmt.Println("    │ Server  │ Conn  │ TTFB  │ TTL   │ Location           │")
-	fmt.Println("┌───┼─────────┼───────┼───────┼───────┼────────────────────┤")
+	for idx, tester := range testers {
+		if batch {
+			fmt.Printf("\n\033[1m%s\033[0m\n", tester.Domain)
+		}
 
-	for _, data := range tester.Report(*sorting) {
-		if data.Status == 1 {
-			icon = "\033[0;32m\u2714\033[0m"
+		if tester.Samples > 1 {
+			PrintStats(tester, *sorting)
 		} else {
-			icon = "\033[0;31m\u2718\033[0m"
+			PrintTable(tester, *sorting)
+		}
+
+		for _, message := range tester.ErrorMessages() {
+			fmt.Println("\033[0;94m\u2022\033[0m " + message.Error())
+		}
+
+		for _, violation := range reports[idx].Violations {
+			fmt.Println("\033[0;31m\u2022\033[0m " + violation.String())
+		}
+	}
+
+	if batch {
+		fmt.Println()
+		PrintSummary(testers)
+	}
+
+	os.Exit(exitCode)
+}
+
+// requestFromFlags builds the HTTP request of the local tests.
+func requestFromFlags() (*Request, error) {
+	request := NewRequest(*method)
+
+	for _, line := range headers {
+		if err := request.AddHeader(line); err != nil {
+			return nil, err
 		}
+	}
+
+	for _, line := range cookies {
+		if err := request.AddCookies(line); err != nil {
+			return nil, err
+		}
+	}
+
+	if *basicAuth != "" {
+		if err := request.SetBasicAuth(*basicAuth); err != nil {
+			return nil, err
+		}
+	}
+
+	if *bearer != "" {
+		request.SetBearer(*bearer)
+	}
 
-		fmt.Printf(
-			"│ %s │ \033[0;2m%s\033[0m │ %s │ %s │ %s │ %s │\n",
-			icon,
-			data.Output.ServerID,
-			Colorize("conn", data.Output.ConnectTime),
-			Colorize("ttfb", data.Output.FirstByteTime),
-			Colorize("ttl", data.Output.TotalTime),
-			pad(data.Output.ServerTitle, 18),
-		)
+	if *body != "" {
+		if err := request.LoadBody(*body); err != nil {
+			return nil, err
+		}
 	}
 
-	fmt.Println("└───┼─────────┼───────┼───────┼───────┼────────────────────┤")
+	// Validate the method and the headers before the tests start.
+	if _, err := request.Build(context.Background(), "http://localhost/"); err != nil {
+		return nil, err
+	}
 
-	fmt.Printf(
-		"    │ Average │ %.3f │ %.3f │ %.3f │ %s │\n",
-		tester.Average(connectionTime),
-		tester.Average(timeToFirstByte),
-		tester.Average(totalTime),
-		PerformanceGrade(tester),
-	)
+	return request, nil
+}
 
-	fmt.Println("    └─────────┴───────┴───────┴───────┴────────────────────┘")
+// isFlagSet returns true if the flag was specified in the command line.
+func isFlagSet(name string) bool {
+	var found bool
+
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+
+	return found
+}
+
+// writeBudgetReport writes the JSON-encoded budget summary into the file, or
+// into the standard error if the filename is a dash, so the standard output
+// remains available for the results.
+func writeBudgetReport(report BudgetReport, filename string) error {
+	if filename == "" {
+		return nil
+	}
+
+	if filename == "-" {
+		return report.Encode(os.Stderr)
+	}
+
+	file, err := os.Create(filename)
+
+	if err != nil {
+		return err
+	}
 
-	for _, message := range tester.ErrorMessages() {
-		fmt.Println("\033[0;94m\u2022\033[0m " + message.Error())
+	if err := report.Encode(file); err != nil {
+		file.Close()
+		return err
 	}
 
-	os.Exit(0)
+	return file.Close()
 }
 
 func pad(text string, length int) string {
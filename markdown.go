@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// LoadResults reads the results printed with "-json", either the list of
+// results of one website or the results grouped by domain name of a batch. The
+// results of one website are returned under an empty domain name.
+func LoadResults(filename string) (map[string][]Result, error) {
+	data, err := os.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Result
+
+	if err := json.Unmarshal(data, &list); err == nil {
+		return map[string][]Result{"": list}, nil
+	}
+
+	results := make(map[string][]Result)
+
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	return results, nil
+}
+
+// baselineFor returns the mean total time per location of the baseline for
+// the domain name, or nil if the baseline does not include the website.
+func baselineFor(baseline map[string][]Result, domain string) map[string]float64 {
+	results, ok := baseline[domain]
+
+	if !ok {
+		results, ok = baseline[""]
+	}
+
+	if !ok {
+		return nil
+	}
+
+	means := make(map[string]float64)
+	tester := &TTFB{Results: results}
+
+	for _, loc := range tester.Locations(totalTime) {
+		if loc.Stats.Count > 0 {
+			means[loc.ServerID] = loc.Stats.Mean
+		}
+	}
+
+	return means
+}
+
+// WriteMarkdown prints the results as GitHub-flavored markdown, which renders
+// the same table as the terminal in a pull request comment. If a baseline is
+// available, an additional column shows the change of the total time of each
+// location compared to the mean of the same location in the baseline.
+func WriteMarkdown(w io.Writer, testers []*TTFB, sorting string, baseline map[string][]Result) error {
+	var b strings.Builder
+
+	for _, tester := range testers {
+		if len(testers) > 1 {
+			fmt.Fprintf(&b, "### %s\n\n", markdownEscape(tester.Domain))
+		}
+
+		means := baselineFor(baseline, tester.Domain)
+
+		if tester.Samples > 1 {
+			markdownStats(&b, tester, sorting)
+		} else {
+			markdownTable(&b, tester, sorting, means)
+		}
+
+		if messages := tester.ErrorMessages(); len(messages) > 0 {
+			b.WriteString("\n**Errors**\n\n")
+			for _, message := range messages {
+				fmt.Fprintf(&b, "- %s\n", markdownEscape(message.Error()))
+			}
+		}
+
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// markdownTable prints one row per test, like PrintTable.
+func markdownTable(b *strings.Builder, tester *TTFB, sorting string, means map[string]float64) {
+	groups := []string{connectionTime, timeToFirstByte, totalTime}
+
+	if tester.HasBreakdown() {
+		groups = []string{
+			nameLookupTime,
+			connectionTime,
+			appConnectTime,
+			preTransferTime,
+			timeToFirstByte,
+			totalTime,
+			redirectTime,
+		}
+	}
+
+	b.WriteString("| | Server |")
+	for _, group := range groups {
+		fmt.Fprintf(b, " %s |", abbrs[group])
+	}
+	if means != nil {
+		b.WriteString(" Δ TTL |")
+	}
+	if tester.Retries > 0 {
+		b.WriteString(" Try |")
+	}
+	b.WriteString(" Location |\n")
+
+	b.WriteString("|---|---|")
+	for range groups {
+		b.WriteString("--:|")
+	}
+	if means != nil {
+		b.WriteString("--:|")
+	}
+	if tester.Retries > 0 {
+		b.WriteString("--:|")
+	}
+	b.WriteString("---|\n")
+
+	for _, data := range tester.Report(sorting) {
+		fmt.Fprintf(b, "| %s | `%s` |", markdownStatus(data), data.Output.ServerID)
+		for _, group := range groups {
+			value, _ := data.Output.Metric(group)
+			fmt.Fprintf(b, " %.3f |", value)
+		}
+		if means != nil {
+			fmt.Fprintf(b, " %s |", markdownDiff(data, means))
+		}
+		if tester.Retries > 0 {
+			fmt.Fprintf(b, " %d |", data.Attempts)
+		}
+		fmt.Fprintf(b, " %s |\n", markdownEscape(data.Output.ServerTitle))
+	}
+
+	b.WriteString("| | **Average** |")
+	for _, group := range groups {
+		fmt.Fprintf(b, " **%.3f** |", tester.Average(group))
+	}
+	if means != nil {
+		b.WriteString(" |")
+	}
+	if tester.Retries > 0 {
+		b.WriteString(" |")
+	}
+	fmt.Fprintf(b, " **Performance: %s** |\n", Score(tester).Grade)
+}
+
+// markdownStats prints one row per location with the statistics of the
+// samples, like PrintStats.
+func markdownStats(b *strings.Builder, tester *TTFB, sorting string) {
+	group, stat := splitSorting(sorting)
+
+	if _, ok := abbrs[group]; !ok {
+		group = timeToFirstByte
+	}
+
+	if stat == "" {
+		stat = statMedian
+	}
+
+	tester.Report(group + ":" + stat)
+
+	fmt.Fprintf(b, "%s statistics, %d samples per location\n\n", abbrs[group], tester.Samples)
+
+	b.WriteString("| | Server | N |")
+	for _, column := range statColumns {
+		fmt.Fprintf(b, " %s |", statAbbrs[column])
+	}
+	b.WriteString(" Location |\n|---|---|--:|")
+	for range statColumns {
+		b.WriteString("--:|")
+	}
+	b.WriteString("---|\n")
+
+	for _, loc := range tester.Locations(group) {
+		icon := "✅"
+
+		if loc.Stats.Count == 0 {
+			icon = "❌"
+		} else if loc.Failures > 0 {
+			icon = "⚠️"
+		}
+
+		fmt.Fprintf(b, "| %s | `%s` | %d |", icon, loc.ServerID, loc.Stats.Count)
+		markdownStatsValues(b, loc.Stats)
+		fmt.Fprintf(b, " %s |\n", markdownEscape(loc.ServerTitle))
+	}
+
+	overall := tester.Statistics(group)
+
+	fmt.Fprintf(b, "| | **Overall** | %d |", overall.Count)
+	markdownStatsValues(b, overall)
+	fmt.Fprintf(b, " **Performance: %s** |\n", Score(tester).Grade)
+}
+
+// markdownStatsValues prints the statistics columns.
+func markdownStatsValues(b *strings.Builder, stats Stats) {
+	for _, column := range statColumns {
+		value, _ := stats.Value(column)
+		fmt.Fprintf(b, " %.3f |", value)
+	}
+}
+
+// markdownStatus returns the emoji that replaces the icons of the terminal.
+func markdownStatus(data Result) string {
+	switch {
+	case data.Status == 1:
+		return "✅"
+	case data.TimedOut:
+		return "⌛"
+	default:
+		return "❌"
+	}
+}
+
+// markdownDiff returns the change of the total time compared to the baseline.
+func markdownDiff(data Result, means map[string]float64) string {
+	base, ok := means[data.Output.ServerID]
+
+	if !ok || data.Status != 1 {
+		return ""
+	}
+
+	diff := data.Output.TotalTime - base
+
+	return fmt.Sprintf("%+.3f (%+.0f%%)", diff, diff/base*100)
+}
+
+// markdownEscape prevents the text from breaking the table.
+func markdownEscape(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(text)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// defaultProber is the name of the prober used when neither the command line
+// nor the configuration file specify one for the testing server.
+const defaultProber string = "sucuri"
+
+// Prober executes one speed test against the website from the perspective of
+// one of the testing servers and returns the measurements. The error is only
+// reported when the test could not be completed, in which case the result must
+// contain, at least, the information returned by TTFB.BasicResult. The prober
+// must stop as soon as the context is done.
+//
+// New backends (self-hosted agents, other public services, etc) are added with
+// RegisterProber and are then available to the "-probe" flag and to the list of
+// servers in the configuration file, "probe = name" in the server section.
+type Prober interface {
+	Probe(ctx context.Context, t *TTFB, unique string) (Result, error)
+}
+
+// probers holds the list of registered probers indexed by their name.
+var probers = map[string]Prober{
+	"sucuri": SucuriProber{},
+	"local":  LocalProber{},
+	"agent":  AgentProber{},
+}
+
+// SucuriProber runs the tests with the remote testing servers provided by the
+// performance.sucuri.net service, see TTFB.ServerCheck.
+type SucuriProber struct{}
+
+// Probe implements the Prober interface.
+func (p SucuriProber) Probe(ctx context.Context, t *TTFB, unique string) (Result, error) {
+	return t.ServerCheck(ctx, unique)
+}
+
+// LocalProber runs the tests from the current internet connection, see
+// TTFB.LocalCheck.
+type LocalProber struct{}
+
+// Probe implements the Prober interface.
+func (p LocalProber) Probe(ctx context.Context, t *TTFB, unique string) (Result, error) {
+	return t.LocalCheck(ctx, unique)
+}
+
+// AgentProber runs the tests with a self-hosted agent, the address of the agent
+// is defined in the section of the server in the configuration file, for
+// example "probe = agent" and "address = http://10.0.0.5:8080/measure", see
+// TTFB.AgentCheck.
+type AgentProber struct{}
+
+// Probe implements the Prober interface.
+func (p AgentProber) Probe(ctx context.Context, t *TTFB, unique string) (Result, error) {
+	return t.AgentCheck(ctx, unique)
+}
+
+// RegisterProber makes a prober available by the specified name. Registering a
+// prober with the name of an existing one replaces the old implementation.
+func RegisterProber(name string, p Prober) {
+	probers[name] = p
+}
+
+// LookupProber returns the prober registered with the specified name.
+func LookupProber(name string) (Prober, error) {
+	if p, ok := probers[name]; ok {
+		return p, nil
+	}
+
+	return nil, fmt.Errorf("unknown prober %q, available: %s", name, ProberNames())
+}
+
+// ProberNames returns a comma separated list with the registered probers.
+func ProberNames() string {
+	var names []string
+
+	for name := range probers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// ProberName returns the name of the prober that will test the website from
+// the specified server. The prober selected in the command line takes priority
+// over the one in the configuration file, which allows to run every test with
+// local resources without editing the list of servers.
+func (t *TTFB) ProberName(unique string) string {
+	if t.Prober != "" {
+		return t.Prober
+	}
+
+	if name := t.Servers[unique].Prober; name != "" {
+		return name
+	}
+
+	return defaultProber
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// redacted replaces the secrets in the messages.
+const redacted string = "[REDACTED]"
+
+// sensitiveHeaders lists the parts of the header names that usually carry
+// credentials, the values of these headers are redacted from the messages.
+var sensitiveHeaders = []string{"auth", "cookie", "token", "key", "secret", "session", "password"}
+
+// Request describes the HTTP request sent by the local tests, by default a GET
+// request without body, which allows to measure API endpoints and pages that
+// require authentication. The values of the credentials are remembered to
+// redact them from the messages.
+type Request struct {
+	Method  string
+	Header  http.Header
+	Body    []byte
+	secrets []string
+}
+
+// listFlag holds the values of a flag that can be specified multiple times.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ", ") }
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// NewRequest returns a new pointer to the Request object.
+func NewRequest(method string) *Request {
+	return &Request{
+		Method: strings.ToUpper(method),
+		Header: make(http.Header),
+	}
+}
+
+// Custom returns true if the request is different than a plain GET request.
+func (r *Request) Custom() bool {
+	return r.Method != http.MethodGet || len(r.Header) > 0 || r.Body != nil
+}
+
+// AddHeader adds one header using the same format as CURL, "Name: value".
+func (r *Request) AddHeader(line string) error {
+	idx := strings.Index(line, ":")
+
+	if idx <= 0 {
+		return fmt.Errorf("header %q must be \"Name: value\"", line)
+	}
+
+	name := strings.TrimSpace(line[:idx])
+	value := strings.TrimSpace(line[idx+1:])
+
+	if !validHeaderName(name) {
+		return fmt.Errorf("header name %q is invalid", name)
+	}
+
+	if !validHeaderValue(value) {
+		return fmt.Errorf("header %q has control characters in the value", name)
+	}
+
+	for _, part := range sensitiveHeaders {
+		if strings.Contains(strings.ToLower(name), part) {
+			r.secret(value)
+			break
+		}
+	}
+
+	r.Header.Add(name, value)
+
+	return nil
+}
+
+// validHeaderName returns true if the name is a token, as defined by the HTTP
+// specification, otherwise the header would corrupt the request.
+//
+// @ref: https://www.rfc-editor.org/rfc/rfc7230#section-3.2.6
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		char := name[i]
+
+		if char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' {
+			continue
+		}
+
+		if !strings.ContainsRune("!#$%&'*+-.^_`|~", rune(char)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validHeaderValue returns false if the value contains control characters,
+// except for the horizontal tab, CR and LF would inject more headers.
+func validHeaderValue(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if char := value[i]; (char < 0x20 && char != '\t') || char == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AddCookies adds the cookies, one or more "name=value" pairs separated by a
+// semicolon, like the Cookie header sent by the web browsers.
+func (r *Request) AddCookies(line string) error {
+	for _, pair := range strings.Split(line, ";") {
+		pair = strings.TrimSpace(pair)
+
+		if pair == "" {
+			continue
+		}
+
+		idx := strings.Index(pair, "=")
+
+		if idx <= 0 {
+			return fmt.Errorf("cookie %q must be \"name=value\"", pair)
+		}
+
+		r.secret(pair[idx+1:])
+
+		// Servers expect all the cookies in one header.
+		if current := r.Header.Get("Cookie"); current != "" {
+			pair = current + "; " + pair
+		}
+
+		r.Header.Set("Cookie", pair)
+	}
+
+	return nil
+}
+
+// SetBasicAuth uses the HTTP basic authentication, "user:password".
+func (r *Request) SetBasicAuth(credentials string) error {
+	idx := strings.Index(credentials, ":")
+
+	if idx < 0 {
+		return errors.New("basic authentication must be \"user:password\"")
+	}
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(credentials))
+
+	r.secret(credentials[idx+1:])
+	r.secret(encoded)
+	r.Header.Set("Authorization", "Basic "+encoded)
+
+	return nil
+}
+
+// SetBearer uses the token in the authorization header.
+func (r *Request) SetBearer(token string) {
+	r.secret(token)
+	r.Header.Set("Authorization", "Bearer "+token)
+}
+
+// LoadBody reads the body of the request from the file, or from the standard
+// input if the filename is a dash.
+func (r *Request) LoadBody(filename string) error {
+	var err error
+
+	if filename == "-" {
+		r.Body, err = io.ReadAll(os.Stdin)
+	} else {
+		r.Body, err = os.ReadFile(filename)
+	}
+
+	return err
+}
+
+// Build returns the HTTP request for the URL. The body can be sent again if
+// the website redirects with a 307 or 308 status code. The Host header, which
+// is ignored by the http package, replaces the host of the URL in the request.
+func (r *Request) Build(ctx context.Context, target string) (*http.Request, error) {
+	if r == nil {
+		return http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	}
+
+	var body io.Reader
+
+	if r.Body != nil {
+		body = bytes.NewReader(r.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.Method, target, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range r.Header {
+		req.Header[name] = append([]string(nil), values...)
+	}
+
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+
+	return req, nil
+}
+
+// secret remembers one value that must not appear in the messages.
+func (r *Request) secret(value string) {
+	if value != "" {
+		r.secrets = append(r.secrets, value)
+	}
+}
+
+// Redact replaces the credentials found in the text.
+func (r *Request) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+
+	for _, value := range r.secrets {
+		text = strings.ReplaceAll(text, value, redacted)
+	}
+
+	return text
+}
+
+// redactedError hides the credentials from the message of the error, the
+// original error is still available to errors.Is and errors.As.
+type redactedError struct {
+	Err  error
+	Text string
+}
+
+func (e *redactedError) Unwrap() error { return e.Err }
+
+func (e *redactedError) Error() string { return e.Text }
+
+// RedactError returns the error without the credentials in its message.
+func (r *Request) RedactError(err error) error {
+	if err == nil || r == nil || len(r.secrets) == 0 {
+		return err
+	}
+
+	return &redactedError{Err: err, Text: r.Redact(err.Error())}
+}
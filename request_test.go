@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAddHeader(t *testing.T) {
+	request := NewRequest("get")
+
+	for _, line := range []string{"Accept: application/json", "X-Trace_ID: a\tb", "Cache-Control:no-cache"} {
+		if err := request.AddHeader(line); err != nil {
+			t.Fatalf("unexpected error for %q: %s", line, err)
+		}
+	}
+
+	if value := request.Header.Get("X-Trace_id"); value != "a\tb" {
+		t.Fatalf("unexpected value %q", value)
+	}
+
+	invalid := map[string]string{
+		"Accept":                     "must be \"Name: value\"",
+		": value":                    "must be \"Name: value\"",
+		"X Header: value":            "header name \"X Header\" is invalid",
+		"X-Header(1): value":         "header name \"X-Header(1)\" is invalid",
+		"Ümlaut: value":              "is invalid",
+		"X-Header: a\r\nInjected: b": "control characters",
+		"X-Header: a\nInjected: b":   "control characters",
+		"X-Header: a\x00b":           "control characters",
+		"X-Header: a\x1bb":           "control characters",
+		"X-Header: a\x7fb":           "control characters",
+	}
+
+	for line, expected := range invalid {
+		if err := request.AddHeader(line); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q for %q, got %v", expected, line, err)
+		}
+	}
+}
+
+func TestBuildHost(t *testing.T) {
+	request := NewRequest("post")
+
+	if err := request.AddHeader("Host: www.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := request.AddHeader("Authorization: Bearer secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := request.Build(context.Background(), "http://192.0.2.1/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if req.Host != "www.example.com" || req.URL.Host != "192.0.2.1" {
+		t.Fatalf("expected the Host header in the request, got %q for %q", req.Host, req.URL.Host)
+	}
+
+	if _, ok := req.Header["Host"]; ok {
+		t.Fatal("unexpected Host in the header map")
+	}
+
+	if req.Method != "POST" || req.Header.Get("Authorization") != "Bearer secret" {
+		t.Fatalf("unexpected request %s %q", req.Method, req.Header)
+	}
+
+	if text := request.Redact("Authorization: Bearer secret"); text != "Authorization: "+redacted {
+		t.Fatalf("expected the token to be redacted, got %q", text)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Pin connects to the IP addresses instead of resolving the host name when the
+// website uses the host and the port, the same as "curl --resolve", which is
+// useful to test a staging origin before the DNS records are changed.
+type Pin struct {
+	Host  string
+	Port  string
+	Addrs []string
+}
+
+// ParsePin parses one entry with the same format as CURL,
+// "host:port:addr[,addr]", IPv6 addresses may be enclosed in brackets.
+func ParsePin(entry string) (Pin, error) {
+	var pin Pin
+
+	parts := strings.SplitN(entry, ":", 3)
+
+	if len(parts) != 3 {
+		return pin, fmt.Errorf("%q must be \"host:port:addr[,addr]\"", entry)
+	}
+
+	host, err := ToASCII(parts[0])
+
+	if err != nil {
+		return pin, fmt.Errorf("%q is invalid: %s", entry, err)
+	}
+
+	if number, err := strconv.Atoi(parts[1]); err != nil || number < 1 || number > 65535 {
+		return pin, fmt.Errorf("%q is invalid: port %q out of range", entry, parts[1])
+	}
+
+	for _, addr := range splitList(parts[2]) {
+		pin.Addrs = append(pin.Addrs, strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"))
+	}
+
+	if len(pin.Addrs) == 0 {
+		return pin, fmt.Errorf("%q is invalid: the address is missing", entry)
+	}
+
+	if err := ValidateAddresses(pin.Addrs); err != nil {
+		return pin, fmt.Errorf("%q is invalid: %s", entry, err)
+	}
+
+	pin.Host = host
+	pin.Port = parts[1]
+
+	return pin, nil
+}
+
+// Matches returns true if the URL uses the host and the port of the entry,
+// without an explicit port the URL uses the default port of the protocol.
+func (p Pin) Matches(target *url.URL) bool {
+	port := target.Port()
+
+	if port == "" {
+		port = "80"
+
+		if target.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return strings.EqualFold(target.Hostname(), p.Host) && port == p.Port
+}
+
+// Addresses returns the IP addresses of the host, both IPv4 and IPv6, without
+// duplicates and in the same order returned by the resolver. If the host is an
+// IP address, the address itself is returned.
+func Addresses(ctx context.Context, host string) ([]string, error) {
+	var list []string
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+
+	for _, ip := range ips {
+		if addr := ip.IP.String(); !seen[addr] {
+			seen[addr] = true
+			list = append(list, addr)
+		}
+	}
+
+	return list, nil
+}
+
+// ValidateAddresses returns an error if one of the values is not an IP address.
+func ValidateAddresses(addrs []string) error {
+	for _, addr := range addrs {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("%q is not an IP address", addr)
+		}
+	}
+
+	return nil
+}
+
+// TestAddresses replaces the testing servers with one local test per IP
+// address, so websites behind multiple DNS records or a CDN report one row per
+// address. The identifiers of the rows are "local01", "local02", etc. If the
+// port is not empty, only the connections to that port use the address.
+func (t *TTFB) TestAddresses(addrs []string, port string) {
+	t.Servers = make(map[string]Server)
+
+	for idx, addr := range addrs {
+		unique := fmt.Sprintf("local%02d", idx+1)
+
+		t.Servers[unique] = Server{
+			ID:      unique,
+			Title:   addr,
+			Prober:  "local",
+			IP:      addr,
+			Port:    port,
+			Enabled: true,
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParsePin(t *testing.T) {
+	pin, err := ParsePin("Staging.Example.com:443:10.0.0.5,[2001:db8::1]")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Pin{Host: "staging.example.com", Port: "443", Addrs: []string{"10.0.0.5", "2001:db8::1"}}
+
+	if !reflect.DeepEqual(pin, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, pin)
+	}
+
+	for _, entry := range []string{"10.0.0.5", "example.com:0:10.0.0.5", "example.com:80:", "example.com:80:nope"} {
+		if _, err := ParsePin(entry); err == nil {
+			t.Fatalf("expected an error for %q", entry)
+		}
+	}
+}
+
+func TestPinMatches(t *testing.T) {
+	pin := Pin{Host: "example.com", Port: "443", Addrs: []string{"10.0.0.5"}}
+
+	tests := map[string]bool{
+		"https://example.com/checkout": true,
+		"https://EXAMPLE.com:443/":     true,
+		"http://example.com/":          false,
+		"https://example.com:8443/":    false,
+		"https://www.example.com/":     false,
+	}
+
+	for raw, expected := range tests {
+		target, err := url.Parse(raw)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if pin.Matches(target) != expected {
+			t.Fatalf("expected %v for %q", expected, raw)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxBackoff limits the time between two attempts of the same test.
+const maxBackoff time.Duration = 30 * time.Second
+
+// TransientError marks a failure that will probably disappear if the test is
+// executed again, for example, when the API service is overloaded (5xx) or is
+// rate limiting the requests (429), in which case the service may suggest how
+// long to wait before the next attempt.
+type TransientError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// NewStatusError returns a TransientError if the HTTP status code of the
+// response describes a temporary failure, or nil otherwise.
+func NewStatusError(res *http.Response) error {
+	if res.StatusCode < http.StatusInternalServerError && res.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	return &TransientError{
+		Err:        errors.New(res.Status),
+		RetryAfter: retryAfter(res.Header.Get("retry-after")),
+	}
+}
+
+// retryAfter parses the value of the Retry-After header, which is either a
+// number of seconds or a date.
+func retryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+// IsTransient returns true if the test failed because of a network error or a
+// temporary failure of the testing server. Tests that were canceled or that
+// timed out are not retried, the timeout is the maximum time the user is
+// willing to wait for each test.
+func IsTransient(err error) bool {
+	var te *TransientError
+	var oe *net.OpError
+	var de *net.DNSError
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// The dialer wraps the DNS errors in a net.OpError, so they are checked
+	// first, otherwise a domain that does not exist would be retried.
+	if errors.As(err, &de) {
+		return de.IsTemporary || de.IsTimeout
+	}
+
+	if errors.As(err, &te) || errors.As(err, &oe) {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Backoff returns the time to wait before the next attempt. The time doubles
+// after every attempt and includes a random jitter, so the tests that failed at
+// the same time do not hit the testing servers at the same time again.
+func Backoff(base time.Duration, attempt int) time.Duration {
+	wait := base
+
+	for i := 1; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+
+	if wait <= 1 {
+		return wait
+	}
+
+	half := wait / 2
+
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
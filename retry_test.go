@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestIsTransient(t *testing.T) {
+	nxdomain := &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}
+	temporary := &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}
+
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{&net.OpError{Op: "dial", Net: "tcp", Err: nxdomain}, false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: temporary}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}, true},
+		{&TransientError{Err: errors.New("503 Service Unavailable")}, true},
+		{fmt.Errorf("body: %w", io.ErrUnexpectedEOF), true},
+		{fmt.Errorf("dial: %w", context.DeadlineExceeded), false},
+		{context.Canceled, false},
+		{errors.New("invalid character"), false},
+	}
+
+	for _, test := range tests {
+		if IsTransient(test.err) != test.transient {
+			t.Fatalf("expected %v for %q", test.transient, test.err)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+const statMin string = "min"
+const statMedian string = "median"
+const statMean string = "mean"
+const statP90 string = "p90"
+const statP99 string = "p99"
+const statMax string = "max"
+const statStdDev string = "stddev"
+
+// Stats holds the statistics of the samples collected for one of the timing
+// groups, either from one location or from all the locations at once.
+type Stats struct {
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	Mean   float64 `json:"mean"`
+	P90    float64 `json:"p90"`
+	P99    float64 `json:"p99"`
+	Max    float64 `json:"max"`
+	StdDev float64 `json:"stddev"`
+}
+
+// Location holds the statistics of the samples collected from one server. The
+// failed samples are not included in the statistics, they are only counted.
+type Location struct {
+	ServerID    string `json:"server_id"`
+	ServerTitle string `json:"server_title"`
+	Failures    int    `json:"failures"`
+	Stats       Stats  `json:"stats"`
+}
+
+// NewStats calculates the statistics of the values. The percentiles use linear
+// interpolation between the closest ranks, so they are meaningful even with a
+// small number of samples.
+func NewStats(values []float64) Stats {
+	var s Stats
+
+	if len(values) == 0 {
+		return s
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	var sum float64
+	var variance float64
+
+	for _, value := range sorted {
+		sum += value
+	}
+
+	s.Count = len(sorted)
+	s.Min = sorted[0]
+	s.Max = sorted[len(sorted)-1]
+	s.Mean = sum / float64(s.Count)
+	s.Median = percentile(sorted, 0.50)
+	s.P90 = percentile(sorted, 0.90)
+	s.P99 = percentile(sorted, 0.99)
+
+	for _, value := range sorted {
+		variance += (value - s.Mean) * (value - s.Mean)
+	}
+
+	if s.Count > 1 {
+		s.StdDev = math.Sqrt(variance / float64(s.Count-1))
+	}
+
+	return s
+}
+
+// percentile returns the value below which a percentage of the sorted values
+// falls, the rank is a number between zero and one.
+func percentile(sorted []float64, rank float64) float64 {
+	pos := rank * float64(len(sorted)-1)
+	low := int(math.Floor(pos))
+	high := int(math.Ceil(pos))
+
+	return sorted[low] + (sorted[high]-sorted[low])*(pos-float64(low))
+}
+
+// Value returns the statistic with the specified name.
+func (s Stats) Value(stat string) (float64, bool) {
+	switch stat {
+	case statMin:
+		return s.Min, true
+	case statMedian:
+		return s.Median, true
+	case statMean:
+		return s.Mean, true
+	case statP90:
+		return s.P90, true
+	case statP99:
+		return s.P99, true
+	case statMax:
+		return s.Max, true
+	case statStdDev:
+		return s.StdDev, true
+	}
+
+	return 0.0, false
+}
+
+// splitSorting separates the timing group and the statistic from the sorting
+// criteria, for example, "ttfb:p90" sorts the locations by the 90th percentile
+// of the time to first byte. The statistic is empty if it was not specified.
+func splitSorting(sorting string) (string, string) {
+	if idx := strings.Index(sorting, ":"); idx >= 0 {
+		return sorting[:idx], sorting[idx+1:]
+	}
+
+	return sorting, ""
+}
+
+// Locations groups the samples by testing server and returns the statistics
+// of the timing group for each one, in the same order the servers appear in
+// the results, which is the order defined by the last call to Report.
+func (t *TTFB) Locations(group string) []Location {
+	var order []string
+
+	values := make(map[string][]float64)
+	locations := make(map[string]*Location)
+
+	for _, data := range t.Results {
+		unique := data.Output.ServerID
+		loc, ok := locations[unique]
+
+		if !ok {
+			loc = &Location{ServerID: unique, ServerTitle: data.Output.ServerTitle}
+			locations[unique] = loc
+			order = append(order, unique)
+		}
+
+		if data.Status != 1 {
+			loc.Failures++
+			continue
+		}
+
+		if value, ok := data.Output.Metric(group); ok {
+			values[unique] = append(values[unique], value)
+		}
+	}
+
+	list := make([]Location, 0, len(order))
+
+	for _, unique := range order {
+		loc := locations[unique]
+		loc.Stats = NewStats(values[unique])
+		list = append(list, *loc)
+	}
+
+	return list
+}
+
+// FailedLocations returns the number of testing servers without a single
+// successful sample.
+func (t *TTFB) FailedLocations() int {
+	var failed int
+
+	for _, loc := range t.Locations(totalTime) {
+		if loc.Stats.Count == 0 {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// Statistics returns the statistics of the timing group using the successful
+// samples from all the testing servers.
+func (t *TTFB) Statistics(group string) Stats {
+	var values []float64
+
+	for _, data := range t.Results {
+		if data.Status != 1 {
+			continue
+		}
+
+		if value, ok := data.Output.Metric(group); ok {
+			values = append(values, value)
+		}
+	}
+
+	return NewStats(values)
+}
+
+// WelchTest compares the means of two groups of samples with unequal variances
+// and returns the probability of observing such a difference if the means were
+// equal, the two-tailed p-value. It is not possible to run the test with less
+// than two samples per group.
+//
+// @ref: https://en.wikipedia.org/wiki/Welch%27s_t-test
+func WelchTest(a Stats, b Stats) (float64, bool) {
+	if a.Count < 2 || b.Count < 2 {
+		return 0, false
+	}
+
+	va := a.StdDev * a.StdDev / float64(a.Count)
+	vb := b.StdDev * b.StdDev / float64(b.Count)
+
+	if va+vb == 0 {
+		// Identical samples on both sides.
+		if a.Mean == b.Mean {
+			return 1, true
+		}
+		return 0, true
+	}
+
+	t := (b.Mean - a.Mean) / math.Sqrt(va+vb)
+	df := (va + vb) * (va + vb) / (va*va/float64(a.Count-1) + vb*vb/float64(b.Count-1))
+
+	return incompleteBeta(df/2, 0.5, df/(df+t*t)), true
+}
+
+// incompleteBeta returns the regularized incomplete beta function, which is
+// used to calculate the cumulative distribution of the Student's t-distribution.
+//
+// @ref: Numerical Recipes in C, 2nd edition, section 6.4
+func incompleteBeta(a float64, b float64, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+
+	if x >= 1 {
+		return 1
+	}
+
+	la, _ := math.Lgamma(a + b)
+	lb, _ := math.Lgamma(a)
+	lc, _ := math.Lgamma(b)
+	front := math.Exp(la - lb - lc + a*math.Log(x) + b*math.Log(1-x))
+
+	// The continued fraction converges faster on this side.
+	if x < (a+1)/(a+b+2) {
+		return front * betaFraction(a, b, x) / a
+	}
+
+	return 1 - front*betaFraction(b, a, 1-x)/b
+}
+
+// betaFraction evaluates the continued fraction of the incomplete beta
+// function with the modified Lentz's method.
+func betaFraction(a float64, b float64, x float64) float64 {
+	const tiny = 1e-30
+
+	c := 1.0
+	d := 1 - (a+b)*x/(a+1)
+
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+
+	d = 1 / d
+	h := d
+
+	for m := 1.0; m <= 200; m++ {
+		num := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+
+		for i := 0; i < 2; i++ {
+			d = 1 + num*d
+			if math.Abs(d) < tiny {
+				d = tiny
+			}
+			c = 1 + num/c
+			if math.Abs(c) < tiny {
+				c = tiny
+			}
+			d = 1 / d
+			h *= d * c
+
+			num = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		}
+
+		if math.Abs(d*c-1) < 3e-12 {
+			break
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// statColumns defines the statistics printed when there are multiple samples.
+var statColumns = []string{statMin, statMedian, statP90, statP99, statStdDev}
+
+// statAbbrs maps the statistics to the column names printed in the table.
+var statAbbrs = map[string]string{
+	statMin:    "Min",
+	statMedian: "Med",
+	statP90:    "P90",
+	statP99:    "P99",
+	statStdDev: "SD",
+}
+
+// PrintTable prints one row per test with the timings of the request and the
+// average of each timing group at the end. The phases of the request before
+// the time to first byte are only included if at least one test reported them.
+func PrintTable(tester *TTFB, sorting string) {
+	var icon string
+
+	groups := []string{connectionTime, timeToFirstByte, totalTime}
+
+	if tester.HasBreakdown() {
+		groups = []string{
+			nameLookupTime,
+			connectionTime,
+			appConnectTime,
+			preTransferTime,
+			timeToFirstByte,
+			totalTime,
+			redirectTime,
+		}
+	}
+
+	columns := len(groups)
+
+	if tester.Retries > 0 {
+		columns++
+	}
+
+	fmt.Println("    " + rule("┌", "┬", "┐", columns))
+	fmt.Print("    │ Server  │")
+	for _, group := range groups {
+		fmt.Printf(" %s │", pad(abbrs[group], 5))
+	}
+	if tester.Retries > 0 {
+		fmt.Print(" Try   │")
+	}
+	fmt.Println(" Location           │")
+	fmt.Println("┌───" + rule("┼", "┼", "┤", columns))
+
+	for _, data := range tester.Report(sorting) {
+		switch {
+		case data.Status == 1:
+			icon = "\033[0;32m\u2714\033[0m"
+		case data.TimedOut:
+			icon = "\033[0;33m\u29D6\033[0m"
+		default:
+			icon = "\033[0;31m\u2718\033[0m"
+		}
+
+		fmt.Printf("│ %s │ \033[0;2m%s\033[0m │", icon, data.Output.ServerID)
+		for _, group := range groups {
+			value, _ := data.Output.Metric(group)
+			fmt.Printf(" %s │", Colorize(group, value))
+		}
+		if tester.Retries > 0 {
+			fmt.Printf(" %s │", pad(fmt.Sprint(data.Attempts), 5))
+		}
+		fmt.Printf(" %s │\n", pad(data.Output.ServerTitle, 18))
+	}
+
+	fmt.Println("└───" + rule("┼", "┼", "┤", columns))
+	fmt.Print("    │ Average │")
+	for _, group := range groups {
+		fmt.Printf(" %.3f │", tester.Average(group))
+	}
+	if tester.Retries > 0 {
+		fmt.Print("       │")
+	}
+	fmt.Printf(" %s │\n", PerformanceGrade(tester))
+	fmt.Println("    " + rule("└", "┴", "┘", columns))
+}
+
+// PrintStats prints one row per location with the number of successful samples
+// and the statistics of one timing group, which is taken from the sorting
+// criteria, or the time to first byte if the criteria is not a timing. The last
+// row contains the statistics of the samples from all the locations.
+func PrintStats(tester *TTFB, sorting string) {
+	var icon string
+
+	group, stat := splitSorting(sorting)
+
+	if _, ok := abbrs[group]; !ok {
+		group = timeToFirstByte
+	}
+
+	if stat == "" {
+		stat = statMedian
+	}
+
+	tester.Report(group + ":" + stat)
+
+	fmt.Printf("    %s statistics, %d samples per location\n", abbrs[group], tester.Samples)
+	fmt.Println("    " + rule("┌", "┬", "┐", len(statColumns)+1))
+	fmt.Print("    │ Server  │ N     │")
+	for _, column := range statColumns {
+		fmt.Printf(" %s │", pad(statAbbrs[column], 5))
+	}
+	fmt.Println(" Location           │")
+	fmt.Println("┌───" + rule("┼", "┼", "┤", len(statColumns)+1))
+
+	for _, loc := range tester.Locations(group) {
+		switch {
+		case loc.Failures == 0:
+			icon = "\033[0;32m\u2714\033[0m"
+		case loc.Stats.Count > 0:
+			icon = "\033[0;33m\u2714\033[0m"
+		default:
+			icon = "\033[0;31m\u2718\033[0m"
+		}
+
+		fmt.Printf("│ %s │ \033[0;2m%s\033[0m │ %s │", icon, loc.ServerID, pad(fmt.Sprint(loc.Stats.Count), 5))
+		printStatsValues(group, loc.Stats)
+		fmt.Printf(" %s │\n", pad(loc.ServerTitle, 18))
+	}
+
+	overall := tester.Statistics(group)
+
+	fmt.Println("└───" + rule("┼", "┼", "┤", len(statColumns)+1))
+	fmt.Printf("    │ Overall │ %s │", pad(fmt.Sprint(overall.Count), 5))
+	printStatsValues(group, overall)
+	fmt.Printf(" %s │\n", PerformanceGrade(tester))
+	fmt.Println("    " + rule("└", "┴", "┘", len(statColumns)+1))
+}
+
+// printStatsValues prints the statistics columns, the standard deviation is
+// not a timing so it is never colorized.
+func printStatsValues(group string, stats Stats) {
+	for _, column := range statColumns {
+		value, _ := stats.Value(column)
+
+		if column == statStdDev {
+			fmt.Printf(" %.3f │", value)
+			continue
+		}
+
+		fmt.Printf(" %s │", Colorize(group, value))
+	}
+}
+
+// rule returns one of the horizontal lines of the table, starting from the
+// column with the server identifier and with one column per timing group.
+func rule(left string, middle string, right string, groups int) string {
+	line := left + strings.Repeat("─", 9) + middle
+
+	for i := 0; i < groups; i++ {
+		line += strings.Repeat("─", 7) + middle
+	}
+
+	return line + strings.Repeat("─", 20) + right
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseTarget validates the website to be tested, which is either a domain
+// name, like "example.com", or a URL with a path and a query string, like
+// "https://example.com:8443/checkout?step=2". Similar to CURL, the protocol is
+// HTTP if omitted. Internationalized domain names are converted to Punycode.
+func ParseTarget(raw string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+
+	if raw == "" {
+		return nil, errors.New("Domain is invalid")
+	}
+
+	target, err := url.Parse(localTarget(raw))
+
+	if err != nil {
+		return nil, fmt.Errorf("URL %q is invalid: %s", raw, unwrapURLError(err))
+	}
+
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil, fmt.Errorf("URL %q is invalid: unsupported scheme %q", raw, target.Scheme)
+	}
+
+	if target.User != nil {
+		return nil, fmt.Errorf("URL %q is invalid: credentials are not supported in the URL", raw)
+	}
+
+	host, err := ToASCII(target.Hostname())
+
+	if err != nil {
+		return nil, fmt.Errorf("URL %q is invalid: %s", raw, err)
+	}
+
+	if port := target.Port(); port != "" {
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return nil, fmt.Errorf("URL %q is invalid: port %q out of range", raw, port)
+		}
+
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	target.Host = host
+	target.Fragment = ""
+	target.RawFragment = ""
+
+	return target, nil
+}
+
+// unwrapURLError removes the operation and the URL from the errors returned
+// by the url package, the URL is already part of the message.
+func unwrapURLError(err error) error {
+	if e, ok := err.(*url.Error); ok {
+		return e.Err
+	}
+
+	return err
+}
+
+// ToASCII converts the host name to the form used by the DNS, the labels with
+// non-ASCII characters are encoded with Punycode and prefixed with "xn--". IP
+// addresses are returned as they are.
+//
+// @ref: https://www.rfc-editor.org/rfc/rfc5891#section-4.4
+func ToASCII(host string) (string, error) {
+	if host == "" {
+		return "", errors.New("host is empty")
+	}
+
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	labels := strings.Split(host, ".")
+
+	for idx, label := range labels {
+		if label == "" {
+			return "", fmt.Errorf("host %q has an empty label", host)
+		}
+
+		if utf8.RuneCountInString(label) != len(label) {
+			label = "xn--" + Punycode(label)
+		}
+
+		if len(label) > 63 {
+			return "", fmt.Errorf("label %q is longer than 63 characters", label)
+		}
+
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("label %q starts or ends with a hyphen", label)
+		}
+
+		for _, char := range label {
+			if !(char >= 'a' && char <= 'z' || char >= '0' && char <= '9' || char == '-' || char == '_') {
+				return "", fmt.Errorf("label %q contains the invalid character %q", label, char)
+			}
+		}
+
+		labels[idx] = label
+	}
+
+	host = strings.Join(labels, ".")
+
+	if len(host) > 253 {
+		return "", errors.New("host is longer than 253 characters")
+	}
+
+	return host, nil
+}
+
+// Punycode parameters defined in the section 5 of the specification.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// Punycode encodes the label with the Bootstring algorithm, the basic code
+// points are copied first and the rest are encoded as variable-length
+// integers after the last hyphen.
+//
+// @ref: https://www.rfc-editor.org/rfc/rfc3492#section-6.3
+func Punycode(label string) string {
+	var out strings.Builder
+
+	input := []rune(label)
+
+	for _, char := range input {
+		if char < 0x80 {
+			out.WriteRune(char)
+		}
+	}
+
+	basic := out.Len()
+	handled := basic
+
+	if basic > 0 {
+		out.WriteByte('-')
+	}
+
+	n := rune(punyInitialN)
+	bias := punyInitialBias
+	delta := 0
+
+	for handled < len(input) {
+		// Next code point to insert, the smallest not handled yet.
+		m := rune(utf8.MaxRune)
+
+		for _, char := range input {
+			if char >= n && char < m {
+				m = char
+			}
+		}
+
+		delta += int(m-n) * (handled + 1)
+		n = m
+
+		for _, char := range input {
+			if char < n {
+				delta++
+			}
+
+			if char != n {
+				continue
+			}
+
+			q := delta
+
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+
+				if q < t {
+					break
+				}
+
+				out.WriteByte(punyDigit(t + (q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+
+			out.WriteByte(punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+
+		delta++
+		n++
+	}
+
+	return out.String()
+}
+
+// punyDigit returns the basic code point of the digit, "a" to "z" for 0 to
+// 25 and "0" to "9" for 26 to 35.
+func punyDigit(digit int) byte {
+	if digit < 26 {
+		return byte('a' + digit)
+	}
+
+	return byte('0' + digit - 26)
+}
+
+// punyAdapt returns the new bias after the insertion of one code point.
+//
+// @ref: https://www.rfc-editor.org/rfc/rfc3492#section-6.1
+func punyAdapt(delta int, points int, first bool) int {
+	var k int
+
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+
+	delta += delta / points
+
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
@@ -0,0 +1,30 @@
+/**
+ * Synthetic fixture for ParseCatalog, written by hand, it is not a copy of the
+ * script served by the service. It covers both shapes accepted by the parser:
+ * the identifier as the key of the object and the identifier as one of its
+ * properties.
+ */
+(function ($) {
+	"use strict";
+
+	var settings = { animate: true, delay: 250 };
+
+	var locations = {
+		"8e84827": { title: "USA, Dallas", lat: 32.7767, lng: -96.797 },
+		"f1506d2": { title: "UK, London", lat: 51.5074, lng: -0.1278 },
+		efae235: { title: 'JP, Tokyo', lat: 35.6762, lng: 139.6503 }
+	};
+
+	var extra = [
+		{ id: "51bd240", name: "Singapore", latitude: "1.3521", longitude: "103.8198" },
+		{ id: "198baae", name: "Australia, \"Sydney\"", latitude: -33.8688, longitude: 151.2093 },
+		{ id: "8e84827", name: "USA, Dallas (duplicate)", latitude: 0, longitude: 0 },
+		{ id: "0000000", name: "Without coordinates" }
+	];
+
+	$.fn.loadtimeParser = function (data) {
+		return this.each(function () {
+			$(this).data("locations", $.extend({}, locations, extra, settings, data));
+		});
+	};
+})(jQuery);
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// maxRedirects defines how many redirections the local probe follows before
+// giving up, the value is the same used by the default HTTP client.
+const maxRedirects int = 10
+
+// Timing holds the timeline of one HTTP request executed from the current
+// internet connection. Every value is measured in seconds since the beginning
+// of the operation, including the redirection steps, which mimics the meaning
+// of the variables that CURL prints with the "-w" option, so the numbers can
+// be compared with the ones reported by the remote testing servers.
+//
+// @ref: https://curl.haxx.se/docs/manpage.html
+type Timing struct {
+	NameLookup    float64 // time_namelookup
+	Connect       float64 // time_connect
+	AppConnect    float64 // time_appconnect
+	PreTransfer   float64 // time_pretransfer
+	StartTransfer float64 // time_starttransfer
+	Total         float64 // time_total
+	Redirect      float64 // time_redirect
+	NumRedirects  int     // num_redirects
+	StatusCode    int     // http_code
+	DownloadSize  int64   // size_download
+	DownloadSpeed float64 // speed_download
+	RemoteAddr    string  // remote_ip:remote_port
+}
+
+// tracer collects the timestamps reported by the httptrace hooks. The hooks
+// can be executed from different goroutines, for example when the transport
+// dials multiple addresses in parallel, so every access is synchronized.
+type tracer struct {
+	sync.Mutex
+	start      time.Time
+	hop        time.Time
+	dnsDone    time.Time
+	connDone   time.Time
+	tlsDone    time.Time
+	gotConn    time.Time
+	firstByte  time.Time
+	remoteAddr string
+}
+
+// ClientTrace returns the hooks that populate the timestamps. GetConn is the
+// first hook executed for every request in the redirection chain, so it resets
+// the values and the final numbers always describe the last request.
+func (r *tracer) ClientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			r.Lock()
+			defer r.Unlock()
+			r.hop = time.Now()
+			r.dnsDone = time.Time{}
+			r.connDone = time.Time{}
+			r.tlsDone = time.Time{}
+			r.gotConn = time.Time{}
+			r.firstByte = time.Time{}
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.Lock()
+			defer r.Unlock()
+			r.dnsDone = time.Now()
+		},
+		ConnectDone: func(network string, addr string, err error) {
+			r.Lock()
+			defer r.Unlock()
+			if err == nil && r.connDone.IsZero() {
+				r.connDone = time.Now()
+			}
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			r.Lock()
+			defer r.Unlock()
+			if err == nil {
+				r.tlsDone = time.Now()
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.Lock()
+			defer r.Unlock()
+			r.gotConn = time.Now()
+			r.remoteAddr = info.Conn.RemoteAddr().String()
+		},
+		GotFirstResponseByte: func() {
+			r.Lock()
+			defer r.Unlock()
+			r.firstByte = time.Now()
+		},
+	}
+}
+
+// since returns the seconds between the beginning of the operation and the
+// timestamp, or the fallback value if the event never happened, for example,
+// there is no DNS lookup when the connection is reused or the host is an IP.
+func (r *tracer) since(event time.Time, fallback float64) float64 {
+	if event.IsZero() {
+		return fallback
+	}
+
+	return event.Sub(r.start).Seconds()
+}
+
+// Measure executes the HTTP request using a new transport, to guarantee that no
+// connection is shared with a previous test, follows the redirections and then
+// reads the entire response body to calculate the total transmission time.
+func Measure(req *http.Request) (Timing, error) {
+	return MeasureAt(req, "", "")
+}
+
+// MeasureAt executes the HTTP request like Measure but connects to the IP
+// address instead of resolving the host name, similar to "curl --resolve".
+// The redirections to the same host use the same IP address, only on the port
+// if one is specified, the TLS handshake still uses the host name. The proxy
+// settings are ignored.
+func MeasureAt(req *http.Request, ip string, port string) (Timing, error) {
+	var timing Timing
+
+	r := &tracer{}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableCompression = true
+
+	if ip != "" {
+		host := req.URL.Hostname()
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+			if name, num, err := net.SplitHostPort(address); err == nil && name == host && (port == "" || num == port) {
+				address = net.JoinHostPort(ip, num)
+			}
+
+			return dialer.DialContext(ctx, network, address)
+		}
+	}
+
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return http.ErrUseLastResponse
+			}
+			timing.NumRedirects = len(via)
+			return nil
+		},
+	}
+
+	r.start = time.Now()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), r.ClientTrace()))
+	res, err := client.Do(req)
+
+	if err != nil {
+		return timing, err
+	}
+
+	size, err := io.Copy(io.Discard, res.Body)
+
+	if err2 := res.Body.Close(); err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		return timing, err
+	}
+
+	end := time.Now()
+
+	r.Lock()
+	defer r.Unlock()
+
+	if timing.NumRedirects > 0 {
+		timing.Redirect = r.since(r.hop, 0)
+	}
+
+	hop := r.since(r.hop, 0)
+	timing.NameLookup = r.since(r.dnsDone, hop)
+	timing.Connect = r.since(r.connDone, timing.NameLookup)
+	timing.AppConnect = r.since(r.tlsDone, 0)
+	timing.PreTransfer = r.since(r.gotConn, timing.Connect)
+	timing.StartTransfer = r.since(r.firstByte, timing.PreTransfer)
+	timing.Total = end.Sub(r.start).Seconds()
+	timing.StatusCode = res.StatusCode
+	timing.DownloadSize = size
+	timing.RemoteAddr = r.remoteAddr
+
+	if timing.Total > 0 {
+		timing.DownloadSpeed = float64(size) / timing.Total
+	}
+
+	return timing, nil
+}
+
+// remoteHost returns the IP address of the remote side of the connection.
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// measureURL runs Measure against the URL and fails the test on error.
+func measureURL(t *testing.T, target string) Timing {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, target, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timing, err := Measure(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return timing
+}
+
+// checkTimeline fails the test if one phase of the request ends before the
+// previous one, every value is measured since the beginning of the operation.
+func checkTimeline(t *testing.T, timing Timing) {
+	t.Helper()
+
+	phases := []float64{timing.Redirect, timing.NameLookup, timing.Connect}
+
+	if timing.AppConnect > 0 {
+		phases = append(phases, timing.AppConnect)
+	}
+
+	phases = append(phases, timing.PreTransfer, timing.StartTransfer, timing.Total)
+
+	for i := 1; i < len(phases); i++ {
+		if phases[i] < phases[i-1] {
+			t.Fatalf("timings decrease at phase %d: %+v", i, timing)
+		}
+	}
+
+	if timing.Total <= 0 {
+		t.Fatalf("expected a total time, got %+v", timing)
+	}
+}
+
+func newTestMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+
+	return mux
+}
+
+func TestMeasure(t *testing.T) {
+	srv := httptest.NewServer(newTestMux())
+	defer srv.Close()
+
+	timing := measureURL(t, srv.URL+"/")
+	checkTimeline(t, timing)
+
+	if timing.StatusCode != http.StatusOK || timing.DownloadSize != 5 {
+		t.Fatalf("expected 200 and 5 bytes, got %+v", timing)
+	}
+
+	if timing.AppConnect != 0 || timing.NumRedirects != 0 || timing.Redirect != 0 {
+		t.Fatalf("expected no TLS and no redirections, got %+v", timing)
+	}
+
+	if timing.RemoteAddr != srv.Listener.Addr().String() {
+		t.Fatalf("expected remote address %s, got %s", srv.Listener.Addr(), timing.RemoteAddr)
+	}
+
+	if timing = measureURL(t, srv.URL+"/missing"); timing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", timing.StatusCode)
+	}
+}
+
+func TestMeasureRedirect(t *testing.T) {
+	srv := httptest.NewServer(newTestMux())
+	defer srv.Close()
+
+	timing := measureURL(t, srv.URL+"/redirect")
+	checkTimeline(t, timing)
+
+	if timing.StatusCode != http.StatusOK || timing.NumRedirects != 1 {
+		t.Fatalf("expected 200 after one redirection, got %+v", timing)
+	}
+
+	if timing.Redirect <= 0 {
+		t.Fatalf("expected a redirection time, got %+v", timing)
+	}
+}
+
+func TestMeasureTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(newTestMux())
+	defer srv.Close()
+
+	// Measure clones the default transport, trust the test certificate.
+	transport := http.DefaultTransport
+	http.DefaultTransport = srv.Client().Transport
+	defer func() { http.DefaultTransport = transport }()
+
+	timing := measureURL(t, srv.URL+"/")
+	checkTimeline(t, timing)
+
+	if timing.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", timing.StatusCode)
+	}
+
+	if timing.AppConnect <= timing.Connect || timing.AppConnect > timing.PreTransfer {
+		t.Fatalf("expected the TLS handshake between the connection and the transfer, got %+v", timing)
+	}
+}
+
+func TestMeasureAt(t *testing.T) {
+	srv := httptest.NewServer(newTestMux())
+	defer srv.Close()
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := url.URL{Scheme: "http", Host: net.JoinHostPort("pinned.invalid", port), Path: "/redirect"}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, target.String(), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timing, err := MeasureAt(req, "127.0.0.1", port)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timing.StatusCode != http.StatusOK || remoteHost(timing.RemoteAddr) != "127.0.0.1" {
+		t.Fatalf("expected 200 from 127.0.0.1, got %+v", timing)
+	}
+
+	if _, err := MeasureAt(req, "127.0.0.1", "1"); err == nil {
+		t.Fatal("expected an error, the port does not match the pinned one")
+	}
+}
@@ -1,29 +1,53 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"os/exec"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 // TTFB holds the list of testing servers and the
 type TTFB struct {
 	Domain   string
+	URL      *url.URL
+	Request  *Request
 	Private  bool
+	Prober   string
+	Samples  int
+	Interval time.Duration
+	Timeout  time.Duration
+	Retries  int
+	Backoff  time.Duration
+	Limiter  *Limiter
 	Messages []error
-	Servers  map[string]string
+	Servers  map[string]Server
 	Results  []Result
 }
 
+// Server holds the information of each testing server.
+type Server struct {
+	ID        string
+	Title     string
+	Prober    string
+	Address   string
+	IP        string
+	Port      string
+	Region    string
+	Tags      []string
+	Enabled   bool
+	Latitude  float64
+	Longitude float64
+}
+
 // Result holds the information of each test case.
 type Result struct {
 	Message        string  `json:"message"`
@@ -37,15 +61,23 @@ type Result struct {
 	IsLastTest     bool    `json:"_is_last_test"`
 	ResetLastTest  bool    `json:"reset_last_test"`
 	DataFromCache  bool    `json:"data_from_cache"`
+	Prober         string  `json:"prober,omitempty"`
+	TimedOut       bool    `json:"timed_out,omitempty"`
+	Attempts       int     `json:"attempts"`
 }
 
 // Info holds the data of each test case.
 type Info struct {
 	Domain          string  `json:"domain"`
 	IP              string  `json:"ip"`
+	NameLookupTime  float64 `json:"namelookup_time,string"`
 	ConnectTime     float64 `json:"connect_time,string"`
+	AppConnectTime  float64 `json:"appconnect_time,string"`
+	PreTransferTime float64 `json:"pretransfer_time,string"`
 	FirstByteTime   float64 `json:"firstbyte_time,string"`
 	TotalTime       float64 `json:"total_time,string"`
+	RedirectTime    float64 `json:"redirect_time,string"`
+	NumRedirects    int     `json:"num_redirects"`
 	DomainID        string  `json:"domain_id"`
 	DomainUnique    string  `json:"domain_unique"`
 	ServerID        string  `json:"server_id"`
@@ -59,6 +91,33 @@ type Info struct {
 	ServerLongitude float64 `json:"server_longitude,string"`
 }
 
+// ProbeError associates the failure of a test with the testing server. Tests
+// that did not finish in time are flagged so they can be reported differently
+// than the failures of the API service.
+type ProbeError struct {
+	ServerID string
+	Timeout  bool
+	Err      error
+}
+
+func (e *ProbeError) Unwrap() error { return e.Err }
+
+func (e *ProbeError) Error() string {
+	if e.Timeout {
+		return e.ServerID + ":\x20timed out, " + e.Err.Error()
+	}
+
+	return e.ServerID + ":\x20" + e.Err.Error()
+}
+
+// outcome holds the result of one test and the error, if any, that occurred
+// during its execution, both travel through the same channel so Analyze is the
+// only goroutine that modifies the list of results and error messages.
+type outcome struct {
+	Data Result
+	Err  error
+}
+
 // ByFilter implements sort.Interface to allow data sorting.
 type ByFilter []Result
 
@@ -66,68 +125,70 @@ func (a ByFilter) Len() int               { return len(a) }
 func (a ByFilter) Swap(i int, j int)      { a[i], a[j] = a[j], a[i] }
 func (a ByFilter) Less(i int, j int) bool { return a[i].Filter < a[j].Filter }
 
-// NewTTFB returns a new pointer to the TTFB interface.
-func NewTTFB(domain string, private bool) (*TTFB, error) {
-	var tester TTFB
-
-	if domain == "" {
-		return nil, errors.New("Domain is invalid")
+// Metric returns the value of the timing associated to the group. The phases
+// of the request before the time to first byte (name lookup, TLS handshake,
+// pre-transfer and redirection) are only reported by the local tests, the
+// remote testing servers leave them empty.
+func (i Info) Metric(group string) (float64, bool) {
+	switch group {
+	case nameLookupTime:
+		return i.NameLookupTime, true
+	case connectionTime:
+		return i.ConnectTime, true
+	case appConnectTime:
+		return i.AppConnectTime, true
+	case preTransferTime:
+		return i.PreTransferTime, true
+	case timeToFirstByte:
+		return i.FirstByteTime, true
+	case totalTime:
+		return i.TotalTime, true
+	case redirectTime:
+		return i.RedirectTime, true
 	}
 
-	tester.Domain = domain   /* track domain name */
-	tester.Private = private /* hide results from public */
-	tester.Servers = make(map[string]string)
+	return 0.0, false
+}
 
-	if err := tester.LoadServers(); err != nil {
-		return nil, err
+// HasBreakdown returns true if at least one test reported the timings of the
+// phases that happen before the time to first byte, see Info.Metric.
+func (t *TTFB) HasBreakdown() bool {
+	for _, data := range t.Results {
+		if data.Output.NameLookupTime > 0 || data.Output.PreTransferTime > 0 {
+			return true
+		}
 	}
 
-	return &tester, nil
+	return false
 }
 
-// LoadServers reads and loads the content of the configuration file.
-func (t *TTFB) LoadServers() error {
-	file, err := os.Open(os.Getenv("HOME") + "/" + config)
+// NewTTFB returns a new pointer to the TTFB interface.
+func NewTTFB(domain string, private bool, cfg *Config) (*TTFB, error) {
+	var tester TTFB
+
+	target, err := ParseTarget(domain)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	defer func() {
-		if err := file.Close(); err != nil {
-			fmt.Println("file.Close", err)
-		}
-	}()
-
-	var line string
-	var name string
-	var unique string
-
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line = scanner.Text()
-
-		if len(line) < 10 {
-			continue
-		}
-
-		// Skip comments using .ini file format.
-		if line[0:1] == ";" || line[0:1] == "#" {
-			continue
-		}
+	tester.Domain = domain   /* track domain name */
+	tester.URL = target      /* normalized address */
+	tester.Private = private /* hide results from public */
+	tester.Servers = make(map[string]Server)
 
-		unique = line[0:7]
-		name = line[9:]
+	if err := tester.LoadServers(cfg); err != nil {
+		return nil, err
+	}
 
-		// Skip servers without name.
-		if name == "" {
-			continue
-		}
+	return &tester, nil
+}
 
-		// Append non-duplicated servers to the list.
-		if _, ok := t.Servers[unique]; !ok {
-			t.Servers[unique] = name
+// LoadServers loads the enabled testing servers from the configuration.
+func (t *TTFB) LoadServers(cfg *Config) error {
+	for _, server := range cfg.Servers {
+		if server.Enabled {
+			t.Servers[server.ID] = server
 		}
 	}
 
@@ -150,7 +211,7 @@ func (t *TTFB) FormData(unique string) string {
 	form.Add("load_time_tester", "1")
 	form.Add("form_action", "test_load_time")
 	form.Add("location", unique)
-	form.Add("domain", t.Domain)
+	form.Add("domain", t.FormValue())
 
 	if t.Private {
 		form.Add("is_private", "true")
@@ -167,7 +228,7 @@ func (t *TTFB) BasicResult(unique string) Result {
 	var data Result
 
 	data.Output.ServerID = unique
-	data.Output.ServerTitle = t.Servers[unique]
+	data.Output.ServerTitle = t.Servers[unique].Title
 
 	return data
 }
@@ -181,21 +242,19 @@ func (t *TTFB) ParseResponse(res io.Reader, unique string) (Result, error) {
 	}
 
 	if data.Status == 0 {
-		return t.BasicResult(unique), errors.New(unique + ":\x20" + data.Message)
+		return t.BasicResult(unique), errors.New(data.Message)
 	}
 
 	return data, nil
 }
 
 // ServerCheck sends the HTTP request to the API service.
-func (t *TTFB) ServerCheck(ch chan Result, unique string) error {
-	client := &http.Client{}
+func (t *TTFB) ServerCheck(ctx context.Context, unique string) (Result, error) {
 	body := bytes.NewBufferString(t.FormData(unique))
-	req, err := http.NewRequest("POST", service, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", service, body)
 
 	if err != nil {
-		ch <- t.BasicResult(unique)
-		return err
+		return t.BasicResult(unique), err
 	}
 
 	req.Header.Set("accept-language", "en-US,en;q=0.8")
@@ -208,11 +267,51 @@ func (t *TTFB) ServerCheck(ch chan Result, unique string) error {
 	req.Header.Set("authority", "performance.sucuri.net")
 	req.Header.Set("x-requested-with", "XMLHttpRequest")
 
+	return t.Submit(req, unique)
+}
+
+// AgentCheck sends the HTTP request to a self-hosted agent, the program running
+// in agent mode in a different machine, see Agent. The request and response
+// use the same format as the API service so both are interchangeable.
+func (t *TTFB) AgentCheck(ctx context.Context, unique string) (Result, error) {
+	address := t.Servers[unique].Address
+
+	if address == "" {
+		return t.BasicResult(unique), errors.New("agent address is missing")
+	}
+
+	body := bytes.NewBufferString(t.FormData(unique))
+	req, err := http.NewRequestWithContext(ctx, "POST", address, body)
+
+	if err != nil {
+		return t.BasicResult(unique), err
+	}
+
+	req.Header.Set("content-type", "application/x-www-form-urlencoded; charset=UTF-8")
+	req.Header.Set("accept", "application/json")
+
+	data, err := t.Submit(req, unique)
+
+	if err != nil {
+		return data, err
+	}
+
+	// Prefer the location configured by the user over the agent's.
+	if title := t.Servers[unique].Title; title != "" {
+		data.Output.ServerTitle = title
+	}
+
+	return data, nil
+}
+
+// Submit executes the HTTP request against the testing server and decodes the
+// JSON-encoded object with the result of the test.
+func (t *TTFB) Submit(req *http.Request, unique string) (Result, error) {
+	client := &http.Client{}
 	res, err := client.Do(req)
 
 	if err != nil {
-		ch <- t.BasicResult(unique)
-		return err
+		return t.BasicResult(unique), err
 	}
 
 	defer func() {
@@ -221,6 +320,10 @@ func (t *TTFB) ServerCheck(ch chan Result, unique string) error {
 		}
 	}()
 
+	if err := NewStatusError(res); err != nil {
+		return t.BasicResult(unique), err
+	}
+
 	var buf bytes.Buffer
 
 	if _, err2 := (&buf).ReadFrom(res.Body); err2 != nil {
@@ -229,68 +332,32 @@ func (t *TTFB) ServerCheck(ch chan Result, unique string) error {
 
 	data, err := t.ParseResponse(&buf, unique)
 
-	if err != nil {
-		ch <- t.BasicResult(unique)
-		return err
+	// Report the HTTP status if the error page is not a JSON object.
+	if err != nil && res.StatusCode >= http.StatusBadRequest {
+		return data, errors.New(res.Status)
 	}
 
-	ch <- data
-	return nil
+	return data, err
 }
 
-// LocalCheck leverages the power of CURL to execute a simple speed test against
-// the specified domain name, the test consists of a single HTTP GET request
-// from the current internet connection and reports the connection time, the
-// time to the first byte, the total transmission time among other things.
-//
-// @ref: https://curl.haxx.se/docs/manpage.html
-func (t *TTFB) LocalCheck(ch chan Result, unique string) error {
-	var stats string
-
-	stats += "{"
-	stats += "\"domain\": \"" + t.Domain + "\","
-	stats += "\"http_code\": %{http_code},"
-	stats += "\"connect_time\": %{time_connect},"
-	stats += "\"firstbyte_time\": %{time_starttransfer},"
-	stats += "\"total_time\": %{time_total},"
-	stats += "\"namelookup\": %{time_namelookup},"
-	stats += "\"redirect_time\": %{time_redirect},"
-	stats += "\"num_redirects\": %{num_redirects},"
-	stats += "\"pretransfer\": %{time_pretransfer},"
-	stats += "\"appconnect\": %{time_appconnect},"
-	stats += "\"download_speed\": %{speed_download},"
-	stats += "\"upload_speed\": %{speed_upload}"
-	stats += "}"
-
-	out, err := exec.Command(
-		"/usr/bin/env", "curl", "-L",
-		"-s", "-o", "/dev/null",
-		"-w", stats, *domain,
-	).CombinedOutput()
+// LocalCheck executes a simple speed test against the specified domain name,
+// the test consists of a single HTTP GET request from the current internet
+// connection and reports the name lookup time, the connection time, the TLS
+// handshake time, the time to the first byte, the total transmission time
+// among other things. The measurements are collected by the httptrace hooks
+// so there is no dependency on external programs.
+func (t *TTFB) LocalCheck(ctx context.Context, unique string) (Result, error) {
+	req, err := t.Request.Build(ctx, t.Target())
 
 	if err != nil {
-		ch <- t.BasicResult(unique)
-		return err
+		return t.BasicResult(unique), t.Request.RedactError(err)
 	}
 
-	var v struct {
-		Domain        string  `json:"domain"`
-		Code          int     `json:"http_code"`
-		ConnectTime   float64 `json:"connect_time"`
-		FirstByteTime float64 `json:"firstbyte_time"`
-		TotalTime     float64 `json:"total_time"`
-		Namelookup    float64 `json:"namelookup"`
-		RedirectTime  float64 `json:"redirect_time"`
-		NumRedirects  int     `json:"num_redirects"`
-		PreTransfer   float64 `json:"pretransfer"`
-		AppConnect    float64 `json:"appconnect"`
-		DownloadSpeed float64 `json:"download_speed"`
-		UploadSpeed   float64 `json:"upload_speed"`
-	}
+	server := t.Servers[unique]
+	timing, err := MeasureAt(req, server.IP, server.Port)
 
-	if err = json.Unmarshal(out, &v); err != nil {
-		ch <- t.BasicResult(unique)
-		return err
+	if err != nil {
+		return t.BasicResult(unique), t.Request.RedactError(err)
 	}
 
 	data := Result{
@@ -304,43 +371,101 @@ func (t *TTFB) LocalCheck(ch chan Result, unique string) error {
 		ResetLastTest:  false,
 		DataFromCache:  false,
 		Output: Info{
-			Domain:        t.Domain,
-			ConnectTime:   v.ConnectTime,
-			FirstByteTime: v.FirstByteTime,
-			TotalTime:     v.TotalTime,
-			ServerID:      "localxx",
-			ServerTitle:   fmt.Sprintf("Local %.2f kB/s", v.DownloadSpeed/1000),
+			Domain:          t.Domain,
+			IP:              remoteHost(timing.RemoteAddr),
+			NameLookupTime:  timing.NameLookup,
+			ConnectTime:     timing.Connect,
+			AppConnectTime:  timing.AppConnect,
+			PreTransferTime: timing.PreTransfer,
+			FirstByteTime:   timing.StartTransfer,
+			TotalTime:       timing.Total,
+			RedirectTime:    timing.Redirect,
+			NumRedirects:    timing.NumRedirects,
+			ServerID:        "localxx",
+			ServerTitle:     fmt.Sprintf("Local %.2f kB/s", timing.DownloadSpeed/1000),
+			RequestTime:     time.Now().Unix(),
 		},
 	}
 
-	if v.Code == 200 {
+	// One row per IP address, see TestAddresses.
+	if server.IP != "" {
+		data.Output.ServerID = unique
+		data.Output.ServerTitle = server.Title
+	}
+
+	// API endpoints may respond with other successful status codes.
+	if timing.StatusCode >= 200 && timing.StatusCode < 300 {
 		data.Status = 1
-		data.Message = t.Domain + " tested successfully"
+		data.Message = t.Request.Redact(t.Domain + " tested successfully")
 	}
 
-	ch <- data
-	return nil
+	return data, nil
+}
+
+// FormValue returns the website as expected by the testing servers. A domain
+// name is sent as it is, after the conversion to Punycode, so the results are
+// grouped with the previous tests of the same website. Anything else, like a
+// path, a query string, a port or the HTTPS protocol, requires the full URL.
+func (t *TTFB) FormValue() string {
+	if t.URL == nil {
+		return t.Domain
+	}
+
+	if t.URL.Scheme == "http" && t.URL.Port() == "" && (t.URL.Path == "" || t.URL.Path == "/") && t.URL.RawQuery == "" {
+		return t.URL.Hostname()
+	}
+
+	return t.URL.String()
+}
+
+// Target returns the URL used by the local tests.
+func (t *TTFB) Target() string {
+	if t.URL == nil {
+		return localTarget(t.Domain)
+	}
+
+	return t.URL.String()
+}
+
+// localTarget returns the URL for the local test. Similar to CURL, if the user
+// omits the protocol the program assumes that the website is served via HTTP,
+// the redirection to HTTPS (if any) is followed and included in the report.
+func localTarget(domain string) string {
+	if strings.Contains(domain, "://") {
+		return domain
+	}
+
+	return "http://" + domain
 }
 
 // Report takes the data generated after the execution of all the HTTP requests
 // and sorts all the values by a specific field in the JSON-encoded object.
 // Currently the program allows sorting by the status of the test, failed tests
 // are listed at the end of the report. The program also allows to sort by the
-// connection time, the time to first byte and the total time, these values are
-// returned as strings and the program parses and converts them to floating
-// points for accessibility.
+// connection time, the time to first byte, the total time and the rest of the
+// phases of the request, these values are returned as strings and the program
+// parses and converts them to floating points for accessibility. When the
+// website was tested multiple times from each location, the criteria can
+// include one of the statistics of the samples, for example "ttfb:p90", and the
+// samples are sorted by the statistic of their location.
 func (t *TTFB) Report(sorting string) []Result {
 	var oldval float64
 
+	group, stat := splitSorting(sorting)
+	stats := make(map[string]Stats)
+
+	if stat != "" {
+		for _, loc := range t.Locations(group) {
+			stats[loc.ServerID] = loc.Stats
+		}
+	}
+
 	for idx, data := range t.Results {
-		switch sorting {
-		case connectionTime:
-			oldval = data.Output.ConnectTime
-		case timeToFirstByte:
-			oldval = data.Output.FirstByteTime
-		case totalTime:
-			oldval = data.Output.TotalTime
-		default:
+		if value, ok := stats[data.Output.ServerID].Value(stat); ok {
+			oldval = value
+		} else if value, ok := data.Output.Metric(group); ok {
+			oldval = value
+		} else {
 			// If the HTTP request status is equal to the integer one we
 			// consider it a successful operation and a failure otherwise. Since
 			// the sort interface works with a less-than comparison by default
@@ -361,55 +486,105 @@ func (t *TTFB) Report(sorting string) []Result {
 		t.Results[idx].Filter = oldval
 	}
 
-	sort.Sort(ByFilter(t.Results))
+	sort.Stable(ByFilter(t.Results))
 
 	return t.Results
 }
 
 // ErrorMessages returns an array of errors for any failure occurred during the
-// execution of the HTTP requests. No error message will be reported when the
-// goroutines are locked, they will all be merged into one big pile of data and
-// then printed at the end of all the operations (reading, parsing, sorting,
-// etc).
+// execution of the HTTP requests. The goroutines deliver the errors through the
+// same channel as the results, so they are collected by Analyze without locks
+// and printed at the end of all the operations (reading, parsing, sorting,
+// etc). Each error is a ProbeError with the identifier of the testing server.
 func (t *TTFB) ErrorMessages() []error {
 	return t.Messages
 }
 
-// Analyze sends a HTTP GET request to the external API service for each testing
+// Failures returns the number of tests that did not complete successfully.
+func (t *TTFB) Failures() int {
+	var failures int
+
+	for _, data := range t.Results {
+		if data.Status != 1 {
+			failures++
+		}
+	}
+
+	return failures
+}
+
+// Analyze sends a HTTP request through the prober associated to each testing
 // server found in the configuration file. Each testing server is supposed to
 // return a JSON-encoded object with information that describes the speed of the
-// website from different locations in the world.
-func (t *TTFB) Analyze(localTest bool, progress bool) {
+// website from different locations in the world. If more than one sample was
+// requested, the tests from the same server are executed one after another,
+// with the configured interval in between, to reduce the noise. The limiter,
+// if any, bounds the number of simultaneous tests and the rate at which they
+// start, and can be shared with other instances to test multiple websites with
+// the same budget.
+//
+// Every test is limited by the timeout, if any, and by the context. When the
+// context is canceled, for example, because the user pressed Ctrl-C, the tests
+// that were interrupted are discarded and the results gathered so far remain
+// available for the report. When the deadline of the context is exceeded, the
+// tests that did not finish, including the ones that never started, are
+// reported as timeouts.
+func (t *TTFB) Analyze(ctx context.Context, progress bool) {
 	var done int
-	total := len(t.Servers)
-	ch := make(chan Result, total)
+	var wg sync.WaitGroup
+
+	samples := t.Samples
+	if samples < 1 {
+		samples = 1
+	}
+
+	total := len(t.Servers) * samples
+	ch := make(chan outcome, total)
 
 	for unique := range t.Servers {
-		go func(ch chan Result, unique string) {
-			var err error
+		wg.Add(1)
+
+		go func(ch chan outcome, unique string) {
+			defer wg.Done()
+
+			var i int
 
-			if localTest {
-				err = t.LocalCheck(ch, unique)
-			} else {
-				err = t.ServerCheck(ch, unique)
+			for ; i < samples; i++ {
+				if i > 0 && !sleep(ctx, t.Interval) {
+					break
+				}
+
+				out, ok := t.sample(ctx, unique)
+
+				if !ok {
+					return
+				}
+
+				ch <- out
 			}
 
-			if err != nil {
-				t.Messages = append(t.Messages, err)
+			// The samples that never started because the deadline was
+			// exceeded are reported as timeouts, not silently dropped.
+			for ; i < samples && ctx.Err() == context.DeadlineExceeded; i++ {
+				ch <- t.expired(ctx, unique)
 			}
 		}(ch, unique)
 	}
 
-	for idx := 0; idx < total; idx++ {
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	for out := range ch {
 		done++
-		data := <-ch
 
 		if progress {
 			// Print a loading message until finished.
 			fmt.Printf("\rTesting %02d/%d ...", done, total)
 		}
 
-		t.Results = append(t.Results, data)
+		t.collect(out)
 	}
 
 	if progress {
@@ -418,32 +593,173 @@ func (t *TTFB) Analyze(localTest bool, progress bool) {
 	}
 }
 
+// expired returns the outcome of a test that never started because the
+// deadline of the context was exceeded.
+func (t *TTFB) expired(ctx context.Context, unique string) outcome {
+	data := t.BasicResult(unique)
+	data.Prober = t.ProberName(unique)
+	data.TimedOut = true
+
+	return outcome{
+		Data: data,
+		Err:  &ProbeError{ServerID: unique, Timeout: true, Err: ctx.Err()},
+	}
+}
+
+// sample runs one test from the testing server. The second value is false if
+// the test was interrupted because the context was canceled, in which case the
+// result must be discarded. Tests that did not finish before the deadline are
+// reported as timeouts.
+func (t *TTFB) sample(ctx context.Context, unique string) (outcome, bool) {
+	data, err := t.Probe(ctx, unique)
+
+	if err != nil && ctx.Err() == context.Canceled {
+		return outcome{}, false
+	}
+
+	if err != nil {
+		timeout := errors.Is(err, context.DeadlineExceeded)
+		data.TimedOut = timeout
+		err = &ProbeError{ServerID: unique, Timeout: timeout, Err: err}
+	}
+
+	return outcome{Data: data, Err: err}, true
+}
+
+// collect adds the result of one test and its error, if any, to the report.
+func (t *TTFB) collect(out outcome) {
+	t.Results = append(t.Results, out.Data)
+
+	if out.Err != nil {
+		t.Messages = append(t.Messages, out.Err)
+	}
+}
+
+// Probe executes one test from the specified server using its prober. Tests
+// that fail because of a transient error are executed again, up to the number
+// of retries, waiting an exponential backoff between attempts. Every attempt
+// runs within the limits of the limiter, which is not held during the backoff,
+// and is canceled if it takes longer than the timeout, if any. If the context
+// is done before the first attempt starts, the error is the one of the context.
+func (t *TTFB) Probe(ctx context.Context, unique string) (Result, error) {
+	var data Result
+
+	name := t.ProberName(unique)
+	prober, err := LookupProber(name)
+
+	if err != nil {
+		return t.BasicResult(unique), err
+	}
+
+	for attempt := 1; ; attempt++ {
+		if t.Limiter.Acquire(ctx) != nil {
+			if attempt == 1 {
+				data = t.BasicResult(unique)
+				data.Prober = name
+				return data, ctx.Err()
+			}
+
+			// Report the previous attempt.
+			return data, err
+		}
+
+		data, err = t.attempt(ctx, prober, unique)
+		t.Limiter.Release()
+		data.Prober = name
+		data.Attempts = attempt
+
+		if err == nil || attempt > t.Retries || !IsTransient(err) {
+			return data, err
+		}
+
+		var te *TransientError
+		wait := Backoff(t.Backoff, attempt)
+
+		if errors.As(err, &te) && te.RetryAfter > wait {
+			wait = te.RetryAfter
+		}
+
+		if !sleep(ctx, wait) {
+			return data, err
+		}
+	}
+}
+
+// attempt executes the test once, limited by the timeout, if any.
+func (t *TTFB) attempt(ctx context.Context, prober Prober, unique string) (Result, error) {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	return prober.Probe(ctx, t, unique)
+}
+
+// sleep waits for the duration or until the context is done, it returns false
+// in the second case.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	if duration <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // Average measures the average responsiveness of each test case ignoring the
 // highest and lowest value to increase the accuracy of the total number. Notice
 // that if the number of successful HTTP requests is lower than 3 it means we
 // cannot use any value because after the removal of the highest and lowest we
 // will be left with nothing so we return zero.
 func (t *TTFB) Average(group string) float64 {
-	var total float64
 	var values []float64
 
 	for _, data := range t.Results {
-		if group == connectionTime {
-			values = append(values, data.Output.ConnectTime)
-			continue
+		if value, ok := data.Output.Metric(group); ok {
+			values = append(values, value)
 		}
+	}
+
+	return trimmedMean(values)
+}
 
-		if group == timeToFirstByte {
-			values = append(values, data.Output.FirstByteTime)
+// SuccessfulAverage is like Average but only uses the successful tests, the
+// failed tests report zero timings which lower the average, so more failures
+// would look like a faster website. With less than 3 successful tests the
+// regular mean is returned instead, and zero if none of the tests succeeded.
+func (t *TTFB) SuccessfulAverage(group string) float64 {
+	var values []float64
+
+	for _, data := range t.Results {
+		if data.Status != 1 {
 			continue
 		}
 
-		if group == totalTime {
-			values = append(values, data.Output.TotalTime)
-			continue
+		if value, ok := data.Output.Metric(group); ok {
+			values = append(values, value)
 		}
 	}
 
+	if len(values) < 3 {
+		return NewStats(values).Mean
+	}
+
+	return trimmedMean(values)
+}
+
+// trimmedMean returns the mean of the values without the highest and lowest,
+// or zero if there are less than 3 values.
+func trimmedMean(values []float64) float64 {
+	var total float64
+
 	// There is no enough data to average.
 	if len(values) < 3 {
 		return 0.0
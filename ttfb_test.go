@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// refusedAddress returns an address where nothing is listening, so every
+// connection is refused immediately.
+func refusedAddress(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := ln.Addr().String()
+
+	if err := ln.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return address
+}
+
+// TestAnalyzeFailures runs many failing tests at once, run with "-race" to
+// check that the results and the errors are collected without data races.
+func TestAnalyzeFailures(t *testing.T) {
+	const total = 50
+
+	address := refusedAddress(t)
+
+	for _, name := range []string{"agent", "local"} {
+		t.Run(name, func(t *testing.T) {
+			tester := &TTFB{
+				Domain:  address,
+				Servers: make(map[string]Server),
+			}
+
+			for i := 0; i < total; i++ {
+				unique := fmt.Sprintf("s%02d", i)
+				tester.Servers[unique] = Server{
+					ID:      unique,
+					Title:   "Server " + unique,
+					Prober:  name,
+					Address: "http://" + address + "/measure",
+				}
+			}
+
+			tester.Analyze(context.Background(), false)
+
+			if len(tester.Results) != total {
+				t.Fatalf("expected %d results, got %d", total, len(tester.Results))
+			}
+
+			if len(tester.Messages) != total {
+				t.Fatalf("expected %d errors, got %d", total, len(tester.Messages))
+			}
+
+			seen := make(map[string]bool)
+
+			for _, err := range tester.Messages {
+				var pe *ProbeError
+
+				if !errors.As(err, &pe) {
+					t.Fatalf("expected *ProbeError, got %T: %s", err, err)
+				}
+
+				if _, ok := tester.Servers[pe.ServerID]; !ok {
+					t.Fatalf("unknown server %q in %q", pe.ServerID, err)
+				}
+
+				seen[pe.ServerID] = true
+			}
+
+			if len(seen) != total {
+				t.Fatalf("expected errors from %d servers, got %d", total, len(seen))
+			}
+
+			if failures := tester.Failures(); failures != total {
+				t.Fatalf("expected %d failures, got %d", total, failures)
+			}
+		})
+	}
+}
+
+// TestAnalyzeDeadline checks that the tests that never started, because the
+// deadline was exceeded while waiting for a worker or for the interval between
+// samples, are reported as timeouts instead of being dropped.
+func TestAnalyzeDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	tester := &TTFB{
+		Domain:   strings.TrimPrefix(srv.URL, "http://"),
+		Servers:  make(map[string]Server),
+		Samples:  3,
+		Interval: time.Hour,
+		Limiter:  NewLimiter(1, 0),
+	}
+
+	for i := 0; i < 4; i++ {
+		unique := fmt.Sprintf("s%02d", i)
+		tester.Servers[unique] = Server{ID: unique, Title: "Server " + unique, Prober: "local"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+
+	tester.Analyze(ctx, false)
+
+	if total := len(tester.Servers) * tester.Samples; len(tester.Results) != total {
+		t.Fatalf("expected %d results, got %d", total, len(tester.Results))
+	}
+
+	var timeouts int
+
+	for _, data := range tester.Results {
+		if data.TimedOut {
+			timeouts++
+		}
+	}
+
+	if timeouts < 2*len(tester.Servers) {
+		t.Fatalf("expected at least %d timeouts, got %d", 2*len(tester.Servers), timeouts)
+	}
+
+	if len(tester.Messages) != timeouts {
+		t.Fatalf("expected %d errors, got %d", timeouts, len(tester.Messages))
+	}
+}
+
+// TestProbeRetriesRateLimited checks that every retry waits for the rate of
+// the limiter, like the first attempt.
+func TestProbeRetriesRateLimited(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	tester := &TTFB{
+		Domain:  "example.com",
+		Retries: 2,
+		Backoff: time.Nanosecond,
+		Limiter: NewLimiter(1, 20),
+		Servers: map[string]Server{
+			"a1": {ID: "a1", Prober: "agent", Address: srv.URL},
+		},
+	}
+
+	start := time.Now()
+	data, err := tester.Probe(context.Background(), "a1")
+
+	if count := atomic.LoadInt32(&requests); err == nil || data.Attempts != 3 || count != 3 {
+		t.Fatalf("expected 3 failed attempts, got %d attempts, %d requests, %v", data.Attempts, count, err)
+	}
+
+	// Three requests at 20 per second, the first one starts immediately.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected the retries to respect the rate, took %s", elapsed)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// AnalyzePair tests two websites from the same testing servers in the same
+// run, which is useful to compare the current and the new hosting provider
+// during a migration. Every server tests both websites back-to-back, so the
+// results of each location share the same network conditions, and the order
+// alternates between samples to avoid favoring one of the websites.
+func AnalyzePair(ctx context.Context, a *TTFB, b *TTFB, progress bool) {
+	type paired struct {
+		Tester *TTFB
+		Out    outcome
+	}
+
+	var done int
+	var wg sync.WaitGroup
+
+	samples := a.Samples
+	if samples < 1 {
+		samples = 1
+	}
+
+	total := len(a.Servers) * samples * 2
+	ch := make(chan paired, total)
+
+	for unique := range a.Servers {
+		wg.Add(1)
+
+		go func(ch chan paired, unique string) {
+			defer wg.Done()
+
+			var i int
+
+			for ; i < samples; i++ {
+				if i > 0 && !sleep(ctx, a.Interval) {
+					break
+				}
+
+				order := []*TTFB{a, b}
+
+				if i%2 == 1 {
+					order = []*TTFB{b, a}
+				}
+
+				for _, tester := range order {
+					out, ok := tester.sample(ctx, unique)
+
+					if !ok {
+						return
+					}
+
+					ch <- paired{Tester: tester, Out: out}
+				}
+			}
+
+			// Same as Analyze, the samples that never started because the
+			// deadline was exceeded are reported as timeouts.
+			for ; i < samples && ctx.Err() == context.DeadlineExceeded; i++ {
+				ch <- paired{Tester: a, Out: a.expired(ctx, unique)}
+				ch <- paired{Tester: b, Out: b.expired(ctx, unique)}
+			}
+		}(ch, unique)
+	}
+
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	for item := range ch {
+		done++
+
+		if progress {
+			// Print a loading message until finished.
+			fmt.Printf("\rTesting %02d/%d ...", done, total)
+		}
+
+		item.Tester.collect(item.Out)
+	}
+
+	if progress {
+		// reset previous line.
+		fmt.Print("\r")
+	}
+}
+
+// Winner returns "A" or "B" depending on which of the values is lower, the
+// equal sign if both are the same at millisecond precision, or a dash if one
+// of the websites failed, in which case the values are zero.
+func Winner(a float64, b float64) string {
+	if a == 0 || b == 0 {
+		return "-"
+	}
+
+	if fmt.Sprintf("%.3f", a) == fmt.Sprintf("%.3f", b) {
+		return "="
+	}
+
+	if a < b {
+		return "A"
+	}
+
+	return "B"
+}
+
+// PrintPair prints one row per location with the timings of both websites
+// next to each other and the website with the lowest total time. The order of
+// the locations follows the sorting criteria applied to the first website.
+// With multiple samples, the values are the medians of each location.
+func PrintPair(a *TTFB, b *TTFB, sorting string) {
+	var icon string
+	var winsA, winsB int
+
+	groups := []string{connectionTime, timeToFirstByte, totalTime}
+	medians := make(map[string]map[string][2]float64)
+
+	a.Report(sorting)
+
+	for _, group := range groups {
+		medians[group] = make(map[string][2]float64)
+
+		for _, loc := range b.Locations(group) {
+			medians[group][loc.ServerID] = [2]float64{0, loc.Stats.Median}
+		}
+
+		for _, loc := range a.Locations(group) {
+			pair := medians[group][loc.ServerID]
+			pair[0] = loc.Stats.Median
+			medians[group][loc.ServerID] = pair
+		}
+	}
+
+	fmt.Printf("    A: %s\n", a.Domain)
+	fmt.Printf("    B: %s\n", b.Domain)
+	fmt.Println("    " + rule("┌", "┬", "┐", 7))
+	fmt.Println("    │ Server  │ ConnA │ ConnB │ TTFBA │ TTFBB │ TTL A │ TTL B │ Win   │ Location           │")
+	fmt.Println("┌───" + rule("┼", "┼", "┤", 7))
+
+	for _, loc := range a.Locations(totalTime) {
+		ttl := medians[totalTime][loc.ServerID]
+		winner := Winner(ttl[0], ttl[1])
+
+		switch {
+		case ttl[0] > 0 && ttl[1] > 0:
+			icon = "\033[0;32m\u2714\033[0m"
+		case ttl[0] > 0 || ttl[1] > 0:
+			icon = "\033[0;33m\u2714\033[0m"
+		default:
+			icon = "\033[0;31m\u2718\033[0m"
+		}
+
+		switch winner {
+		case "A":
+			winsA++
+		case "B":
+			winsB++
+		}
+
+		fmt.Printf("│ %s │ \033[0;2m%s\033[0m │", icon, loc.ServerID)
+		for _, group := range groups {
+			pair := medians[group][loc.ServerID]
+			fmt.Printf(" %s │ %s │", Colorize(group, pair[0]), Colorize(group, pair[1]))
+		}
+		fmt.Printf(" %s │ %s │\n", pad(winner, 5), pad(loc.ServerTitle, 18))
+	}
+
+	fmt.Println("└───" + rule("┼", "┼", "┤", 7))
+	fmt.Print("    │ Average │")
+	for _, group := range groups {
+		fmt.Printf(" %.3f │ %.3f │", a.Average(group), b.Average(group))
+	}
+	fmt.Printf(" %s │ %s │\n", pad(Winner(a.Average(totalTime), b.Average(totalTime)), 5), pad(fmt.Sprintf("Grade %s vs %s", Score(a).Grade, Score(b).Grade), 18))
+	fmt.Println("    " + rule("└", "┴", "┘", 7))
+	fmt.Printf("    A is faster in %d location(s), B is faster in %d location(s)\n", winsA, winsB)
+}